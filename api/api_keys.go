@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix starts every API key. Keys are "pdm_<id>_<secret>"; only a
+// SHA-256 hash of the secret is stored.
+const apiKeyPrefix = "pdm_"
+
+type APIKey struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Role        string `json:"role"`
+	Key         string `json:"key,omitempty"`
+	RotatedFrom string `json:"rotated_from,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	LastUsedAt  string `json:"last_used_at,omitempty"`
+	RevokedAt   string `json:"revoked_at,omitempty"`
+}
+
+const apiKeyColumns = `id, name, role, COALESCE(rotated_from, ''), created_at, COALESCE(expires_at, ''), COALESCE(last_used_at, ''), COALESCE(revoked_at, '')`
+
+func scanAPIKey(scan func(dest ...interface{}) error) (APIKey, error) {
+	var key APIKey
+	err := scan(&key.ID, &key.Name, &key.Role, &key.RotatedFrom, &key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+	return key, err
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// insertAPIKey generates and stores a new key. The secret is only returned
+// here and cannot be recovered later.
+func insertAPIKey(exec interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, name, role, rotatedFrom string, expiresAt *time.Time) (APIKey, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return APIKey{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	key := APIKey{ID: id, Name: name, Role: role, RotatedFrom: rotatedFrom, Key: apiKeyPrefix + id + "_" + secret}
+	var expires, from interface{}
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+		key.ExpiresAt = expiresAt.UTC().Format("2006-01-02 15:04:05")
+	}
+	if rotatedFrom != "" {
+		from = rotatedFrom
+	}
+	now := time.Now().UTC()
+	key.CreatedAt = now.Format("2006-01-02 15:04:05")
+	_, err = exec.Exec(`INSERT INTO api_keys (id, name, role, key_hash, rotated_from, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, name, role, hashSecret(secret), from, now, expires)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// IssueAPIKey Issues a new API key
+// @Summary      Issue API key
+// @Description  Create an API key with a role; the key is only shown in this response
+// @Tags         /keys
+// @Accept       name, role, expiry
+// @Produce      api key
+func (r *Repository) IssueAPIKey(ctx context.Context, name, role string, expiresAt *time.Time) (APIKey, error) {
+	if strings.TrimSpace(name) == "" {
+		return APIKey{}, invalidf("name is required")
+	}
+	if !validRole(role) {
+		return APIKey{}, invalidf("invalid role %q", role)
+	}
+	return insertAPIKey(r.db, name, role, "", expiresAt)
+}
+
+// ListAPIKeys List API keys
+// @Summary      List API keys
+// @Description  List API keys without their secrets
+// @Tags         /keys
+// @Produce      api keys
+func (r *Repository) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RotateAPIKey Rotates an API key
+// @Summary      Rotate API key
+// @Description  Issue a replacement key with the same name and role; the old key keeps working for the grace period
+// @Tags         /keys/{id}/rotate
+// @Accept       id, grace period
+// @Produce      api key
+func (r *Repository) RotateAPIKey(ctx context.Context, id string, grace time.Duration) (APIKey, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return APIKey{}, err
+	}
+	defer tx.Rollback()
+
+	old, err := scanAPIKey(tx.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ? AND revoked_at IS NULL FOR UPDATE`, id).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return APIKey{}, fmt.Errorf("api key %w", errNotFound)
+		}
+		return APIKey{}, err
+	}
+
+	key, err := insertAPIKey(tx, old.Name, old.Role, old.ID, nil)
+	if err != nil {
+		return APIKey{}, err
+	}
+	expires := time.Now().UTC().Add(grace)
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, ?), ?) WHERE id = ?`, expires, expires, id); err != nil {
+		return APIKey{}, err
+	}
+	return key, tx.Commit()
+}
+
+// RevokeAPIKey Revokes an API key
+// @Summary      Revoke API key
+// @Description  Revoke an API key immediately
+// @Tags         /keys/{id}
+// @Accept       id
+// @Produce      error
+func (r *Repository) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("api key %w", errNotFound)
+	}
+	return nil
+}
+
+// authenticateAPIKey returns the principal of a valid, unexpired and
+// unrevoked key.
+func (r *Repository) authenticateAPIKey(ctx context.Context, key string) (*Principal, error) {
+	invalid := invalidf("invalid api key")
+	id, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !strings.HasPrefix(key, apiKeyPrefix) || !ok {
+		return nil, invalid
+	}
+
+	var name, role, hash string
+	err := r.db.QueryRowContext(ctx, `SELECT name, role, key_hash FROM api_keys WHERE id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`,
+		id, time.Now().UTC()).Scan(&name, &role, &hash)
+	if err == sql.ErrNoRows {
+		return nil, invalid
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(hash)) != 1 {
+		return nil, invalid
+	}
+
+	// Record use at most once a minute to keep writes down
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		now, id, now.Add(-time.Minute)); err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: "key:" + id, Name: name, Roles: []string{role}, Via: "api_key"}, nil
+}
+
+// apiKeyActive reports whether the key with id exists and is unexpired and
+// unrevoked, for bearer tokens issued from it.
+func (r *Repository) apiKeyActive(ctx context.Context, id string) (bool, error) {
+	var active bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?))`,
+		id, time.Now().UTC()).Scan(&active)
+	return active, err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// List API keys Handler
+func ListAPIKeysHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := repository.ListAPIKeys(r.Context())
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// Issue API key Handler
+func IssueAPIKeyHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name      string `json:"name"`
+			Role      string `json:"role"`
+			ExpiresIn string `json:"expires_in"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var expiresAt *time.Time
+		if body.ExpiresIn != "" {
+			ttl, err := time.ParseDuration(body.ExpiresIn)
+			if err != nil || ttl <= 0 {
+				http.Error(w, "invalid expires_in", http.StatusBadRequest)
+				return
+			}
+			expires := time.Now().Add(ttl)
+			expiresAt = &expires
+		}
+
+		key, err := repository.IssueAPIKey(r.Context(), body.Name, body.Role, expiresAt)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+// Rotate API key Handler
+func RotateAPIKeyHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			GracePeriod string `json:"grace_period"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		grace := 24 * time.Hour
+		if body.GracePeriod != "" {
+			var err error
+			if grace, err = time.ParseDuration(body.GracePeriod); err != nil || grace < 0 {
+				http.Error(w, "invalid grace_period", http.StatusBadRequest)
+				return
+			}
+		}
+
+		key, err := repository.RotateAPIKey(r.Context(), mux.Vars(r)["id"], grace)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+// Revoke API key Handler
+func RevokeAPIKeyHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := repository.RevokeAPIKey(r.Context(), mux.Vars(r)["id"]); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Issue bearer token Handler
+func IssueTokenHandler(auth *Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auth == nil {
+			http.Error(w, "authentication is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		// Tokens are exchanged for API keys, so they cannot be renewed indefinitely
+		principal, ok := principalFromContext(r.Context())
+		if !ok || principal.Via != "api_key" {
+			http.Error(w, "tokens can only be issued for an API key", http.StatusForbidden)
+			return
+		}
+
+		token, expires, err := auth.IssueToken(principal)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int(time.Until(expires).Seconds()),
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// auditGenesisHash is the previous hash of the first audit entry.
+var auditGenesisHash = strings.Repeat("0", 64)
+
+// auditTimeFormat is how audit timestamps are stored and hashed.
+const auditTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// AuditEntry is one mutation in the append-only audit log. Hash covers every
+// other field and the previous entry's hash, so changing, removing or
+// reordering entries breaks the chain.
+type AuditEntry struct {
+	Seq        int64           `json:"seq"`
+	OccurredAt string          `json:"occurred_at"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id"`
+	Action     string          `json:"action"`
+	Entity     string          `json:"entity"`
+	EntityID   string          `json:"entity_id"`
+	Details    json.RawMessage `json:"details"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// auditHash returns the hex SHA-256 of the entry's previous hash, a newline
+// and the compact JSON of its fields from seq to details, in declaration
+// order. tools/audit-verify computes the same hash.
+func auditHash(e AuditEntry) (string, error) {
+	data, err := json.Marshal(struct {
+		Seq        int64           `json:"seq"`
+		OccurredAt string          `json:"occurred_at"`
+		Actor      string          `json:"actor"`
+		RequestID  string          `json:"request_id"`
+		Action     string          `json:"action"`
+		Entity     string          `json:"entity"`
+		EntityID   string          `json:"entity_id"`
+		Details    json.RawMessage `json:"details"`
+	}{e.Seq, e.OccurredAt, e.Actor, e.RequestID, e.Action, e.Entity, e.EntityID, e.Details})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AppendAudit adds an entry to the end of the audit log, filling in its
+// sequence number, timestamp and hashes. Concurrent appends that pick the
+// same sequence number are retried.
+func (r *Repository) AppendAudit(ctx context.Context, entry AuditEntry) (AuditEntry, error) {
+	if len(entry.Details) == 0 {
+		entry.Details = json.RawMessage(`{}`)
+	}
+	var details bytes.Buffer
+	if err := json.Compact(&details, entry.Details); err != nil {
+		return AuditEntry{}, fmt.Errorf("invalid audit details: %v", err)
+	}
+	entry.Details = details.Bytes()
+
+	for attempt := 0; ; attempt++ {
+		appended, err := r.appendAudit(ctx, entry)
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 && attempt < 5 {
+			continue
+		}
+		return appended, err
+	}
+}
+
+func (r *Repository) appendAudit(ctx context.Context, entry AuditEntry) (AuditEntry, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	defer tx.Rollback()
+
+	entry.Seq, entry.PrevHash = 1, auditGenesisHash
+	err = tx.QueryRowContext(ctx, `SELECT seq + 1, hash FROM audit_log ORDER BY seq DESC LIMIT 1 FOR UPDATE`).Scan(&entry.Seq, &entry.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return AuditEntry{}, err
+	}
+	entry.OccurredAt = time.Now().UTC().Format(auditTimeFormat)
+	if entry.Hash, err = auditHash(entry); err != nil {
+		return AuditEntry{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO audit_log (seq, occurred_at, actor, request_id, action, entity, entity_id, details, prev_hash, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Seq, entry.OccurredAt, entry.Actor, entry.RequestID, entry.Action, entry.Entity, entry.EntityID, string(entry.Details), entry.PrevHash, entry.Hash)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	return entry, tx.Commit()
+}
+
+// appendSystemAudit records a change made outside an HTTP request, such as
+// by a background job or a command-line flag.
+func (r *Repository) appendSystemAudit(ctx context.Context, actor, action, entity, entityID string, details interface{}) error {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = r.AppendAudit(ctx, AuditEntry{Actor: actor, Action: action, Entity: entity, EntityID: entityID, Details: data})
+	return err
+}
+
+const auditColumns = `seq, occurred_at, actor, request_id, action, entity, entity_id, details, prev_hash, hash`
+
+func scanAuditEntry(scan func(dest ...interface{}) error) (AuditEntry, error) {
+	var entry AuditEntry
+	var details []byte
+	err := scan(&entry.Seq, &entry.OccurredAt, &entry.Actor, &entry.RequestID, &entry.Action, &entry.Entity, &entry.EntityID, &details, &entry.PrevHash, &entry.Hash)
+	entry.Details = details
+	return entry, err
+}
+
+type AuditFilter struct {
+	Entity   string
+	EntityID string
+	AfterSeq int64
+	Limit    int
+}
+
+// ListAuditEntries List audit log entries
+// @Summary      List audit log
+// @Description  List audit log entries in order, optionally for one entity
+// @Tags         /audit
+// @Accept       entity, entity id, after, limit
+// @Produce      audit entries
+func (r *Repository) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_log WHERE seq > ?`
+	args := []interface{}{filter.AfterSeq}
+	if filter.Entity != "" {
+		query += ` AND entity = ?`
+		args = append(args, filter.Entity)
+	}
+	if filter.EntityID != "" {
+		query += ` AND entity_id = ?`
+		args = append(args, filter.EntityID)
+	}
+	query += ` ORDER BY seq`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	entries := []AuditEntry{}
+	err := r.eachAuditEntry(ctx, query, args, func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// EachAuditEntry calls fn with every audit entry in order, without loading
+// the whole log into memory.
+func (r *Repository) EachAuditEntry(ctx context.Context, fn func(AuditEntry) error) error {
+	return r.eachAuditEntry(ctx, `SELECT `+auditColumns+` FROM audit_log ORDER BY seq`, nil, fn)
+}
+
+func (r *Repository) eachAuditEntry(ctx context.Context, query string, args []interface{}, fn func(AuditEntry) error) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows.Scan)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+type AuditProblem struct {
+	Seq     int64  `json:"seq"`
+	Message string `json:"message"`
+}
+
+// AuditVerification is the result of checking the audit chain. HeadSeq and
+// HeadHash identify the last entry; recording them elsewhere lets a later
+// check also detect entries removed from the end.
+type AuditVerification struct {
+	Valid    bool           `json:"valid"`
+	Entries  int64          `json:"entries"`
+	HeadSeq  int64          `json:"head_seq"`
+	HeadHash string         `json:"head_hash"`
+	Problems []AuditProblem `json:"problems"`
+}
+
+// AuditAnchor is a sequence number and hash recorded from an earlier
+// verification. Checking against it detects entries removed from the end of
+// the log, which the chain alone cannot.
+type AuditAnchor struct {
+	Seq  int64
+	Hash string
+}
+
+// auditVerifier checks entries one at a time, in sequence order.
+type auditVerifier struct {
+	result      AuditVerification
+	anchor      *AuditAnchor
+	anchorFound bool
+}
+
+func newAuditVerifier(anchor *AuditAnchor) *auditVerifier {
+	return &auditVerifier{result: AuditVerification{HeadHash: auditGenesisHash, Problems: []AuditProblem{}}, anchor: anchor}
+}
+
+func (v *auditVerifier) add(entry AuditEntry) {
+	problem := func(format string, args ...interface{}) {
+		v.result.Problems = append(v.result.Problems, AuditProblem{Seq: entry.Seq, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch expected := v.result.HeadSeq + 1; {
+	case entry.Seq == expected+1:
+		problem("entry %d is missing", expected)
+	case entry.Seq > expected:
+		problem("entries %d to %d are missing", expected, entry.Seq-1)
+	case entry.Seq < expected:
+		problem("entry is out of order or duplicated after entry %d", v.result.HeadSeq)
+	}
+	if entry.PrevHash != v.result.HeadHash {
+		problem("previous hash does not match the hash of entry %d", v.result.HeadSeq)
+	}
+	if hash, err := auditHash(entry); err != nil {
+		problem("cannot hash entry: %v", err)
+	} else if hash != entry.Hash {
+		problem("entry has been modified: its hash does not match its contents")
+	}
+	if v.anchor != nil && entry.Seq == v.anchor.Seq {
+		v.anchorFound = true
+		if entry.Hash != v.anchor.Hash {
+			problem("hash does not match the recorded anchor")
+		}
+	}
+
+	v.result.Entries++
+	v.result.HeadSeq, v.result.HeadHash = entry.Seq, entry.Hash
+}
+
+func (v *auditVerifier) done() AuditVerification {
+	if v.anchor != nil && !v.anchorFound {
+		v.result.Problems = append(v.result.Problems, AuditProblem{Seq: v.anchor.Seq, Message: "recorded anchor entry is missing: the log has been truncated"})
+	}
+	v.result.Valid = len(v.result.Problems) == 0
+	return v.result
+}
+
+// VerifyAuditLog Verifies the audit log
+// @Summary      Verify audit log
+// @Description  Recompute the hash chain and report gaps, broken links, modified entries and truncation before an anchor
+// @Tags         /audit/verify
+// @Accept       anchor
+// @Produce      verification
+func (r *Repository) VerifyAuditLog(ctx context.Context, anchor *AuditAnchor) (AuditVerification, error) {
+	verifier := newAuditVerifier(anchor)
+	err := r.EachAuditEntry(ctx, func(entry AuditEntry) error {
+		verifier.add(entry)
+		return nil
+	})
+	if err != nil {
+		return AuditVerification{}, err
+	}
+	return verifier.done(), nil
+}
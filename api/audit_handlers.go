@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxAuditBody is the largest request body stored in an audit entry; larger
+// bodies are recorded by hash only.
+const maxAuditBody = 64 << 10
+
+// maxAuditedRequestBody is the largest body of a request that changes data.
+// The audit middleware reads the whole body before the handler runs.
+const maxAuditedRequestBody = 8 << 20
+
+// auditRecorder holds back the response until its audit entry has been
+// appended, so that a request whose change cannot be audited fails instead
+// of succeeding silently.
+type auditRecorder struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *auditRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *auditRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// flush sends the held back response.
+func (w *auditRecorder) flush() {
+	for key, values := range w.header {
+		w.ResponseWriter.Header()[key] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// auditEntityIDVars are the route variables that name the entity a request
+// changes, in order of preference.
+var auditEntityIDVars = []string{"id", "name", "currency"}
+
+// AuditMiddleware appends an audit entry for every successful request that
+// is not a GET, HEAD or OPTIONS. It must run after authentication so that
+// the actor is known. The response is only sent once the entry has been
+// appended; when appending fails the client gets a 500 instead, although
+// the change itself may already have been committed.
+func AuditMiddleware(repository *Repository) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if r.Body != nil {
+				var err error
+				if body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxAuditedRequestBody)); err != nil {
+					var tooLarge *http.MaxBytesError
+					if errors.As(err, &tooLarge) {
+						http.Error(w, fmt.Sprintf("request body is larger than %d bytes", maxAuditedRequestBody), http.StatusRequestEntityTooLarge)
+						return
+					}
+					http.Error(w, "failed to read the request body", http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			recorder := &auditRecorder{ResponseWriter: w, header: http.Header{}}
+			next.ServeHTTP(recorder, r)
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			if recorder.status >= 400 {
+				recorder.flush()
+				return
+			}
+
+			entry := newAuditEntry(r, recorder, body)
+			if _, err := repository.AppendAudit(context.WithoutCancel(r.Context()), entry); err != nil {
+				internalError(w, r, fmt.Errorf("failed to append the audit entry of %s: %v", entry.Action, err))
+				return
+			}
+			recorder.flush()
+		})
+	}
+}
+
+func newAuditEntry(r *http.Request, recorder *auditRecorder, body []byte) AuditEntry {
+	template := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if t, err := route.GetPathTemplate(); err == nil {
+			template = t
+		}
+	}
+	vars := mux.Vars(r)
+
+	entry := AuditEntry{
+		Actor:     "anonymous",
+		RequestID: requestIDFromContext(r.Context()),
+		Action:    r.Method + " " + template,
+		Entity:    strings.SplitN(strings.TrimPrefix(template, "/"), "/", 2)[0],
+	}
+	if principal, ok := principalFromContext(r.Context()); ok {
+		entry.Actor = principal.Subject
+	}
+	for _, name := range auditEntityIDVars {
+		if value := vars[name]; value != "" {
+			entry.EntityID = value
+			break
+		}
+	}
+	if entry.EntityID == "" {
+		var created struct {
+			ID interface{} `json:"id"`
+		}
+		if json.Unmarshal(recorder.body.Bytes(), &created) == nil && created.ID != nil {
+			entry.EntityID = fmt.Sprint(created.ID)
+		}
+	}
+
+	details := map[string]interface{}{"path": r.URL.Path, "status": recorder.status}
+	if len(vars) > 0 {
+		details["vars"] = vars
+	}
+	if r.URL.RawQuery != "" {
+		details["query"] = r.URL.RawQuery
+	}
+	if len(body) > 0 {
+		if len(body) <= maxAuditBody && json.Valid(body) {
+			details["body"] = json.RawMessage(body)
+		} else {
+			details["body_sha256"] = hashSecret(string(body))
+			details["body_length"] = len(body)
+		}
+	}
+	entry.Details = mustJSON(details)
+	return entry
+}
+
+func mustJSON(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return []byte(`null`)
+	}
+	return data
+}
+
+// List audit log Handler
+func ListAuditHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := AuditFilter{Entity: query.Get("entity"), EntityID: query.Get("entity_id"), Limit: 100}
+		if value := query.Get("after"); value != "" {
+			after, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid after", http.StatusBadRequest)
+				return
+			}
+			filter.AfterSeq = after
+		}
+		if value := query.Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 || limit > 1000 {
+				http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := repository.ListAuditEntries(r.Context(), filter)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// Verify audit log Handler
+func VerifyAuditHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var anchor *AuditAnchor
+		if value := r.URL.Query().Get("anchor_seq"); value != "" {
+			seq, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seq <= 0 {
+				http.Error(w, "invalid anchor_seq", http.StatusBadRequest)
+				return
+			}
+			anchor = &AuditAnchor{Seq: seq, Hash: r.URL.Query().Get("anchor_hash")}
+		}
+
+		verification, err := repository.VerifyAuditLog(r.Context(), anchor)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(verification)
+	}
+}
+
+// Export audit log Handler streams the whole log as JSON lines, the input of
+// tools/audit-verify.
+func ExportAuditHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		encoder := json.NewEncoder(w)
+		err := repository.EachAuditEntry(r.Context(), func(entry AuditEntry) error {
+			return encoder.Encode(entry)
+		})
+		if err != nil {
+			// The status is already sent, so a truncated export is the only signal
+			slog.ErrorContext(r.Context(), "Failed to export audit log", "error", err)
+		}
+	}
+}
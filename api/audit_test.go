@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// auditChain returns n correctly chained entries.
+func auditChain(t *testing.T, n int) []AuditEntry {
+	t.Helper()
+	entries := make([]AuditEntry, n)
+	prev := auditGenesisHash
+	for i := range entries {
+		e := AuditEntry{
+			Seq:        int64(i + 1),
+			OccurredAt: fmt.Sprintf("2024-01-01T00:00:%02d.000000Z", i),
+			Actor:      "key:abc",
+			RequestID:  fmt.Sprintf("req-%d", i+1),
+			Action:     "PUT /parts/{id}",
+			Entity:     "parts",
+			EntityID:   "42",
+			Details:    json.RawMessage(`{"status":200}`),
+			PrevHash:   prev,
+		}
+		hash, err := auditHash(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Hash, prev = hash, hash
+		entries[i] = e
+	}
+	return entries
+}
+
+func TestAuditHash(t *testing.T) {
+	// tools/audit-verify tests the same entry and hash. encoding/json escapes
+	// <, > and & in the hashed JSON.
+	e := AuditEntry{
+		Seq:        1,
+		OccurredAt: "2024-05-01T12:00:00.000000Z",
+		Actor:      "key:abc",
+		RequestID:  "req-1",
+		Action:     "POST /parts",
+		Entity:     "parts",
+		EntityID:   "42",
+		Details:    json.RawMessage(`{"body":{"name":"Bolt <M6>"},"status":201}`),
+		PrevHash:   auditGenesisHash,
+	}
+	hash, err := auditHash(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ca7122c67077da2e0c99302eaf9cffe30b42c2c230bed05580b3efd3254bc8ed"; hash != want {
+		t.Errorf("auditHash = %s, want %s", hash, want)
+	}
+}
+
+func TestAuditVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func([]AuditEntry) []AuditEntry
+		anchor   func([]AuditEntry) *AuditAnchor
+		problems []AuditProblem
+	}{
+		{
+			name: "intact chain",
+			edit: func(e []AuditEntry) []AuditEntry { return e },
+		},
+		{
+			name:   "intact chain with anchor",
+			edit:   func(e []AuditEntry) []AuditEntry { return e },
+			anchor: func(e []AuditEntry) *AuditAnchor { return &AuditAnchor{Seq: 3, Hash: e[2].Hash} },
+		},
+		{
+			name: "modified details",
+			edit: func(e []AuditEntry) []AuditEntry {
+				e[1].Details = json.RawMessage(`{"status":201}`)
+				return e
+			},
+			problems: []AuditProblem{{Seq: 2, Message: "entry has been modified: its hash does not match its contents"}},
+		},
+		{
+			name: "modified and rehashed entry breaks the next link",
+			edit: func(e []AuditEntry) []AuditEntry {
+				e[1].Actor = "key:other"
+				e[1].Hash, _ = auditHash(e[1])
+				return e
+			},
+			problems: []AuditProblem{{Seq: 3, Message: "previous hash does not match the hash of entry 2"}},
+		},
+		{
+			name: "one entry removed",
+			edit: func(e []AuditEntry) []AuditEntry { return append(e[:1:1], e[2:]...) },
+			problems: []AuditProblem{
+				{Seq: 3, Message: "entry 2 is missing"},
+				{Seq: 3, Message: "previous hash does not match the hash of entry 1"},
+			},
+		},
+		{
+			name: "several entries removed",
+			edit: func(e []AuditEntry) []AuditEntry { return append(e[:1:1], e[3:]...) },
+			problems: []AuditProblem{
+				{Seq: 4, Message: "entries 2 to 3 are missing"},
+				{Seq: 4, Message: "previous hash does not match the hash of entry 1"},
+			},
+		},
+		{
+			name: "entries swapped",
+			edit: func(e []AuditEntry) []AuditEntry {
+				e[1], e[2] = e[2], e[1]
+				return e
+			},
+			problems: []AuditProblem{
+				{Seq: 3, Message: "entry 2 is missing"},
+				{Seq: 3, Message: "previous hash does not match the hash of entry 1"},
+				{Seq: 2, Message: "entry is out of order or duplicated after entry 3"},
+				{Seq: 2, Message: "previous hash does not match the hash of entry 3"},
+				{Seq: 4, Message: "entry 3 is missing"},
+				{Seq: 4, Message: "previous hash does not match the hash of entry 2"},
+			},
+		},
+		{
+			name:     "truncated before the anchor",
+			edit:     func(e []AuditEntry) []AuditEntry { return e[:3] },
+			anchor:   func(e []AuditEntry) *AuditAnchor { return &AuditAnchor{Seq: 4, Hash: e[3].Hash} },
+			problems: []AuditProblem{{Seq: 4, Message: "recorded anchor entry is missing: the log has been truncated"}},
+		},
+		{
+			name:     "anchor hash differs",
+			edit:     func(e []AuditEntry) []AuditEntry { return e },
+			anchor:   func(e []AuditEntry) *AuditAnchor { return &AuditAnchor{Seq: 2, Hash: e[3].Hash} },
+			problems: []AuditProblem{{Seq: 2, Message: "hash does not match the recorded anchor"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := auditChain(t, 4)
+			var anchor *AuditAnchor
+			if tt.anchor != nil {
+				anchor = tt.anchor(entries)
+			}
+			entries = tt.edit(entries)
+
+			verifier := newAuditVerifier(anchor)
+			for _, e := range entries {
+				verifier.add(e)
+			}
+			result := verifier.done()
+
+			want := tt.problems
+			if want == nil {
+				want = []AuditProblem{}
+			}
+			if !reflect.DeepEqual(result.Problems, want) {
+				t.Errorf("problems = %v, want %v", result.Problems, want)
+			}
+			if result.Valid != (len(want) == 0) {
+				t.Errorf("valid = %v with %d problems", result.Valid, len(want))
+			}
+			last := entries[len(entries)-1]
+			if result.Entries != int64(len(entries)) || result.HeadSeq != last.Seq || result.HeadHash != last.Hash {
+				t.Errorf("head = %d entries, %d %s, want %d, %d %s", result.Entries, result.HeadSeq, result.HeadHash, len(entries), last.Seq, last.Hash)
+			}
+		})
+	}
+}
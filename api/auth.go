@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Authenticator checks the credentials of every request and the permission
+// its route needs. Callers send an API key in X-API-Key or as
+// "Authorization: ApiKey <key>", a bearer token from POST /auth/token, or
+// the session cookie set by OIDC login.
+type Authenticator struct {
+	repository    *Repository
+	tokenSecret   []byte
+	tokenTTL      time.Duration
+	oidc          *OIDCProvider
+	sessionTTL    time.Duration
+	secureCookies bool
+}
+
+// anonymousRole is the role of every request while authentication is
+// disabled. Overridden by AUTH_DISABLED_ROLE.
+var anonymousRole = RoleAdmin
+
+// NewAuthenticatorFromEnv configures authentication from the environment.
+// It returns nil when AUTH_DISABLED is true, and requests then run as the
+// anonymous principal with AUTH_DISABLED_ROLE (default admin). Tokens are
+// signed with AUTH_TOKEN_SECRET, or a random secret that changes on
+// restart, and last AUTH_TOKEN_TTL (default 1h). OIDC sessions last
+// SESSION_TTL (default 8h).
+func NewAuthenticatorFromEnv(repository *Repository) (*Authenticator, error) {
+	if os.Getenv("AUTH_DISABLED") == "true" {
+		if value := os.Getenv("AUTH_DISABLED_ROLE"); value != "" {
+			if !validRole(value) {
+				return nil, fmt.Errorf("invalid AUTH_DISABLED_ROLE %q", value)
+			}
+			anonymousRole = value
+		}
+		slog.Warn("Authentication is disabled", "role", anonymousRole)
+		return nil, nil
+	}
+
+	auth := &Authenticator{repository: repository, tokenSecret: []byte(os.Getenv("AUTH_TOKEN_SECRET")), tokenTTL: time.Hour}
+	if len(auth.tokenSecret) == 0 {
+		secret, err := randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		auth.tokenSecret = []byte(secret)
+		slog.Warn("AUTH_TOKEN_SECRET is not set; bearer tokens will not survive a restart")
+	}
+	if value := os.Getenv("AUTH_TOKEN_TTL"); value != "" {
+		ttl, err := parsePositiveDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTH_TOKEN_TTL: %v", err)
+		}
+		auth.tokenTTL = ttl
+	}
+
+	oidc, err := NewOIDCProviderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	auth.oidc = oidc
+	auth.sessionTTL = 8 * time.Hour
+	if value := os.Getenv("SESSION_TTL"); value != "" {
+		ttl, err := parsePositiveDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SESSION_TTL: %v", err)
+		}
+		auth.sessionTTL = ttl
+	}
+	if oidc != nil {
+		auth.secureCookies = strings.HasPrefix(oidc.RedirectURL, "https://")
+	}
+	return auth, nil
+}
+
+// authenticate returns the principal of the request's credentials, or nil
+// when it has none.
+func (a *Authenticator) authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return a.repository.authenticateAPIKey(r.Context(), key)
+	}
+
+	scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	switch strings.ToLower(scheme) {
+	case "":
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			return a.repository.authenticateSession(r.Context(), cookie.Value)
+		}
+		return nil, nil
+	case "apikey":
+		return a.repository.authenticateAPIKey(r.Context(), credentials)
+	case "bearer":
+		return a.verifyToken(r.Context(), credentials)
+	default:
+		return nil, invalidf("unsupported authorization scheme %q", scheme)
+	}
+}
+
+// Middleware rejects requests without valid credentials or without the
+// permission of the matched route, and stores the principal in the context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				path = template
+			}
+		}
+		if publicRoutes[r.Method+" "+path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := a.authenticate(r)
+		if token := r.URL.Query().Get("access_token"); err == nil && principal == nil && token != "" && queryTokenRoutes[r.Method+" "+path] {
+			principal, err = a.verifyToken(r.Context(), token)
+		}
+		if err == nil && principal == nil {
+			err = invalidf("authentication required")
+		}
+		var invalid *validationError
+		if err != nil && !errors.As(err, &invalid) {
+			internalError(w, r, err)
+			return
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer, ApiKey`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Browsers send the session cookie on their own, so mutating requests must prove they came from the UI
+		if principal.Via == "session" && r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-CSRF-Token")), []byte(principal.csrfToken)) != 1 {
+				http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		if perm := routePermission(r.Method, path); !principal.Can(perm) {
+			http.Error(w, fmt.Sprintf("forbidden: requires %s", perm), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal)))
+	})
+}
+
+// AnonymousMiddleware runs every request as the anonymous principal with
+// anonymousRole. It replaces Authenticator.Middleware while authentication
+// is disabled, so that route permissions and cost visibility still follow a
+// role rather than being skipped.
+func AnonymousMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := &Principal{Subject: "anonymous", Roles: []string{anonymousRole}, Via: "anonymous"}
+		if perm := routePermission(r.Method, routeTemplate(r)); !publicRoutes[r.Method+" "+routeTemplate(r)] && !principal.Can(perm) {
+			http.Error(w, fmt.Sprintf("forbidden: requires %s", perm), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal)))
+	})
+}
+
+type tokenClaims struct {
+	Subject   string   `json:"sub"`
+	KeyID     string   `json:"key"`
+	Name      string   `json:"name,omitempty"`
+	Roles     []string `json:"roles"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// IssueToken returns an HS256 JWT for the principal of an API key and its
+// expiry. The token carries the key's ID, so it stops working as soon as the
+// key is revoked or its rotation grace period ends.
+func (a *Authenticator) IssueToken(principal *Principal) (string, time.Time, error) {
+	keyID, ok := strings.CutPrefix(principal.Subject, "key:")
+	if !ok || principal.Via != "api_key" {
+		return "", time.Time{}, fmt.Errorf("tokens can only be issued for an API key")
+	}
+	now := time.Now()
+	expires := now.Add(a.tokenTTL)
+	claims, err := json.Marshal(tokenClaims{Subject: principal.Subject, KeyID: keyID, Name: principal.Name, Roles: principal.Roles, IssuedAt: now.Unix(), ExpiresAt: expires.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signed := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signed + "." + a.sign(signed), expires, nil
+}
+
+func (a *Authenticator) sign(signed string) string {
+	mac := hmac.New(sha256.New, a.tokenSecret)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyToken checks a token issued by IssueToken and that the API key it
+// was issued for is still valid.
+func (a *Authenticator) verifyToken(ctx context.Context, token string) (*Principal, error) {
+	invalid := invalidf("invalid bearer token")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, invalid
+	}
+	if !hmac.Equal([]byte(a.sign(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return nil, invalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalid
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, invalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, invalidf("bearer token has expired")
+	}
+	if claims.KeyID == "" {
+		return nil, invalid
+	}
+	active, err := a.repository.apiKeyActive(ctx, claims.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, invalidf("the api key of the bearer token has been revoked or has expired")
+	}
+	return &Principal{Subject: claims.Subject, Name: claims.Name, Roles: claims.Roles, Via: "token"}, nil
+}
+
+// signValue returns v as signed JSON, for cookies the client must not change.
+func (a *Authenticator) signValue(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + a.sign(payload), nil
+}
+
+// verifyValue checks a value from signValue and decodes it into v.
+func (a *Authenticator) verifyValue(signed string, v interface{}) error {
+	payload, signature, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(a.sign(payload)), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return decodeSegment(payload, v)
+}
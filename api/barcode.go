@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// code128Patterns holds the bar and space widths of every Code 128 symbol,
+// indexed by symbol value. The last entry is the stop pattern.
+var code128Patterns = []string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = 106
+)
+
+// code128Modules encodes printable ASCII as Code 128 (code set B) and returns
+// the modules from the first bar to the last, true for a bar. Quiet zones
+// are left to the caller.
+func code128Modules(data string) ([]bool, error) {
+	if data == "" {
+		return nil, invalidf("barcode data is empty")
+	}
+
+	symbols := []int{code128StartB}
+	checksum := code128StartB
+	for i, c := range []byte(data) {
+		if c < 32 || c > 126 {
+			return nil, invalidf("code128 cannot encode %q", data)
+		}
+		symbols = append(symbols, int(c)-32)
+		checksum += (i + 1) * (int(c) - 32)
+	}
+	symbols = append(symbols, checksum%103, code128Stop)
+
+	var modules []bool
+	for _, symbol := range symbols {
+		for i, width := range code128Patterns[symbol] {
+			for n := 0; n < int(width-'0'); n++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+	return modules, nil
+}
+
+// gtinCheckDigit returns the GS1 check digit for the digits before it.
+func gtinCheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// normalizeGTIN removes spaces and dashes from a GTIN-8, UPC-A (GTIN-12),
+// EAN-13 or GTIN-14 and checks its check digit.
+func normalizeGTIN(gtin string) (string, error) {
+	gtin = strings.NewReplacer(" ", "", "-", "").Replace(gtin)
+	if gtin == "" {
+		return "", nil
+	}
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return "", invalidf("GTIN %q must have 8, 12, 13 or 14 digits", gtin)
+	}
+	for _, c := range gtin {
+		if c < '0' || c > '9' {
+			return "", invalidf("GTIN %q must only contain digits", gtin)
+		}
+	}
+	if gtinCheckDigit(gtin[:len(gtin)-1]) != gtin[len(gtin)-1] {
+		return "", invalidf("GTIN %q has an invalid check digit", gtin)
+	}
+	return gtin, nil
+}
+
+func (p *Part) normalizeGTIN() error {
+	gtin, err := normalizeGTIN(p.GTIN)
+	if err != nil {
+		return err
+	}
+	p.GTIN = gtin
+	return nil
+}
+
+// EAN-13 digit patterns. Right-hand digits use the complement of the L
+// patterns, and the first digit selects the L/G parity of the left half.
+var (
+	ean13L      = []string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	ean13G      = []string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+	ean13Parity = []string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+// ean13Modules encodes an EAN-13, or a UPC-A as an EAN-13 with a leading
+// zero, and returns its 95 modules.
+func ean13Modules(gtin string) ([]bool, error) {
+	gtin, err := normalizeGTIN(gtin)
+	if err != nil {
+		return nil, err
+	}
+	switch len(gtin) {
+	case 12:
+		gtin = "0" + gtin
+	case 13:
+	default:
+		return nil, invalidf("ean13 needs a 12 or 13 digit GTIN, not %q", gtin)
+	}
+
+	pattern := "101"
+	parity := ean13Parity[gtin[0]-'0']
+	for i := 1; i <= 6; i++ {
+		d := gtin[i] - '0'
+		if parity[i-1] == 'G' {
+			pattern += ean13G[d]
+		} else {
+			pattern += ean13L[d]
+		}
+	}
+	pattern += "01010"
+	for i := 7; i <= 12; i++ {
+		for _, c := range ean13L[gtin[i]-'0'] {
+			if c == '0' {
+				pattern += "1"
+			} else {
+				pattern += "0"
+			}
+		}
+	}
+	pattern += "101"
+
+	modules := make([]bool, len(pattern))
+	for i := range pattern {
+		modules[i] = pattern[i] == '1'
+	}
+	return modules, nil
+}
+
+// Barcode is a grid of modules, true for dark, with the quiet zone the
+// symbology needs around it. Linear barcodes have a single row that is
+// stretched to the image height.
+type Barcode struct {
+	Rows      [][]bool
+	QuietZone int
+}
+
+// NewBarcode encodes data as a code128, ean13 or qr barcode.
+func NewBarcode(kind, data string) (Barcode, error) {
+	switch kind {
+	case "code128":
+		modules, err := code128Modules(data)
+		return Barcode{Rows: [][]bool{modules}, QuietZone: 10}, err
+	case "ean13":
+		modules, err := ean13Modules(data)
+		return Barcode{Rows: [][]bool{modules}, QuietZone: 11}, err
+	case "qr":
+		rows, err := qrEncode(data)
+		return Barcode{Rows: rows, QuietZone: 4}, err
+	default:
+		return Barcode{}, invalidf("unknown barcode type %q", kind)
+	}
+}
+
+// size returns the image size in pixels for scale pixels per module. Linear
+// barcodes are height pixels high.
+func (b Barcode) size(scale, height int) (int, int) {
+	width := (len(b.Rows[0]) + 2*b.QuietZone) * scale
+	if len(b.Rows) == 1 {
+		return width, height
+	}
+	return width, (len(b.Rows) + 2*b.QuietZone) * scale
+}
+
+// dark reports whether the pixel at x, y is dark.
+func (b Barcode) dark(x, y, scale, height int) bool {
+	column := x/scale - b.QuietZone
+	row := 0
+	if len(b.Rows) > 1 {
+		row = y/scale - b.QuietZone
+	}
+	return row >= 0 && row < len(b.Rows) && column >= 0 && column < len(b.Rows[row]) && b.Rows[row][column]
+}
+
+// PNG renders the barcode as a black and white PNG.
+func (b Barcode) PNG(scale, height int) ([]byte, error) {
+	width, imageHeight := b.size(scale, height)
+	img := image.NewPaletted(image.Rect(0, 0, width, imageHeight), color.Palette{color.White, color.Black})
+	for y := 0; y < imageHeight; y++ {
+		for x := 0; x < width; x++ {
+			if b.dark(x, y, scale, height) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the barcode as an SVG with one rectangle per run of dark
+// modules.
+func (b Barcode) SVG(scale, height int) []byte {
+	width, imageHeight := b.size(scale, height)
+	moduleHeight := scale
+	if len(b.Rows) == 1 {
+		moduleHeight = height
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, width, imageHeight, width, imageHeight)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/>`, width, imageHeight)
+	for r, row := range b.Rows {
+		y := (r + b.QuietZone) * scale
+		if len(b.Rows) == 1 {
+			y = 0
+		}
+		for i := 0; i < len(row); {
+			if !row[i] {
+				i++
+				continue
+			}
+			start := i
+			for i < len(row) && row[i] {
+				i++
+			}
+			fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d"/>`, (start+b.QuietZone)*scale, y, (i-start)*scale, moduleHeight)
+		}
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
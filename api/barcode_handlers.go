@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// uiBaseURL is where the web UI is served, for QR codes that open a part.
+// It can be overridden with UI_BASE_URL.
+var uiBaseURL = "http://localhost:3000"
+
+// partURL returns the UI link to a part.
+func partURL(id string) string {
+	return uiBaseURL + "/update?id=" + id
+}
+
+// Part barcode Handler
+func PartBarcodeHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		part, err := repository.GetPart(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		kind := r.URL.Query().Get("type")
+		if kind == "" {
+			kind = "code128"
+		}
+		var data string
+		switch {
+		case kind == "qr":
+			data = partURL(part.ID)
+		case kind == "ean13" || r.URL.Query().Get("value") == "gtin":
+			if part.GTIN == "" {
+				http.Error(w, "part has no GTIN", http.StatusBadRequest)
+				return
+			}
+			data = part.GTIN
+		default:
+			if part.SKU == "" {
+				http.Error(w, "part has no SKU", http.StatusBadRequest)
+				return
+			}
+			data = part.SKU
+		}
+
+		barcode, err := NewBarcode(kind, data)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		scale, height := 2, 80
+		if kind == "qr" {
+			scale = 4
+		}
+		if value := r.URL.Query().Get("scale"); value != "" {
+			if scale, err = strconv.Atoi(value); err != nil || scale < 1 || scale > 20 {
+				http.Error(w, "scale must be between 1 and 20", http.StatusBadRequest)
+				return
+			}
+		}
+		if value := r.URL.Query().Get("height"); value != "" {
+			if height, err = strconv.Atoi(value); err != nil || height < 10 || height > 1000 {
+				http.Error(w, "height must be between 10 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		switch r.URL.Query().Get("format") {
+		case "svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write(barcode.SVG(scale, height))
+		case "", "png":
+			image, err := barcode.PNG(scale, height)
+			if err != nil {
+				internalError(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(image)
+		default:
+			http.Error(w, "format must be png or svg", http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func moduleString(modules []bool) string {
+	var b strings.Builder
+	for _, dark := range modules {
+		if dark {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+func TestNormalizeGTIN(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      bool
+	}{
+		{in: "", want: ""},
+		{in: "4006381333931", want: "4006381333931"},
+		{in: "4006-381 333931", want: "4006381333931"},
+		{in: "036000291452", want: "036000291452"},
+		{in: "96385074", want: "96385074"},
+		{in: "10614141000415", want: "10614141000415"},
+		{in: "4006381333932", err: true},
+		{in: "400638133393", err: true},
+		{in: "40063813339A1", err: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeGTIN(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("normalizeGTIN(%q) = %q, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeGTIN(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestEAN13Modules(t *testing.T) {
+	tests := []struct {
+		gtin string
+		want string
+		err  bool
+	}{
+		{gtin: "5901234123457", want: "10100010110100111011001100100110111101001110101010110011011011001000010101110010011101000100101"},
+		{gtin: "4006381333931", want: "10100011010100111010111101111010001001011001101010100001010000101000010111010010000101100110101"},
+		// UPC-A is encoded as an EAN-13 with a leading zero
+		{gtin: "036000291452", want: "10100011010111101010111100011010001101000110101010110110011101001100110101110010011101101100101"},
+		{gtin: "96385074", err: true},
+		{gtin: "5901234123458", err: true},
+	}
+	for _, tt := range tests {
+		modules, err := ean13Modules(tt.gtin)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ean13Modules(%q) succeeded, want an error", tt.gtin)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ean13Modules(%q): %v", tt.gtin, err)
+			continue
+		}
+		if got := moduleString(modules); got != tt.want {
+			t.Errorf("ean13Modules(%q) =\n%s, want\n%s", tt.gtin, got, tt.want)
+		}
+	}
+}
+
+func TestCode128Modules(t *testing.T) {
+	const (
+		startB = "11010010000"
+		stop   = "1100011101011"
+	)
+	tests := []struct {
+		data string
+		want string
+		err  bool
+	}{
+		// "A" is symbol 33; the check symbol is (104 + 1*33) % 103 = 34
+		{data: "A", want: startB + "10100011000" + "10001011000" + stop},
+		// " " is symbol 0 and "~" symbol 94; check (104 + 0 + 2*94) % 103 = 86
+		{data: " ~", want: startB + "11011001100" + "10001011110" + "11110100100" + stop},
+		{data: "", err: true},
+		{data: "é", err: true},
+		{data: "tab\t", err: true},
+	}
+	for _, tt := range tests {
+		modules, err := code128Modules(tt.data)
+		if tt.err {
+			if err == nil {
+				t.Errorf("code128Modules(%q) succeeded, want an error", tt.data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("code128Modules(%q): %v", tt.data, err)
+			continue
+		}
+		if got := moduleString(modules); got != tt.want {
+			t.Errorf("code128Modules(%q) =\n%s, want\n%s", tt.data, got, tt.want)
+		}
+	}
+
+	// Every symbol is 11 modules wide and the stop pattern 13
+	modules, err := code128Modules("PART-0042")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 11*(len("PART-0042")+2) + 13; len(modules) != want {
+		t.Errorf("code128Modules length = %d, want %d", len(modules), want)
+	}
+}
+
+// gf256 is GF(2^8) with the QR code polynomial, built independently of the
+// encoder's multiplication.
+type gf256 struct {
+	exp [512]byte
+	log [256]int
+}
+
+func newGF256() *gf256 {
+	g := &gf256{}
+	x := 1
+	for i := 0; i < 255; i++ {
+		g.exp[i], g.exp[i+255] = byte(x), byte(x)
+		g.log[x] = i
+		if x <<= 1; x >= 256 {
+			x ^= 0x11D
+		}
+	}
+	return g
+}
+
+func (g *gf256) mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return g.exp[g.log[a]+g.log[b]]
+}
+
+// qrDecodeSingleBlock reads a QR code of version 1 to 3, which have a single
+// error correction block, and returns its byte mode payload. It checks the
+// format information and that the Reed-Solomon syndromes are zero.
+func qrDecodeSingleBlock(t *testing.T, modules [][]bool) string {
+	t.Helper()
+	size := len(modules)
+	version := (size - 17) / 4
+	if version < 1 || version > 3 || 17+4*version != size {
+		t.Fatalf("unexpected size %d", size)
+	}
+	at := func(x, y int) bool { return modules[y][x] }
+
+	// Format information, both copies
+	var first, second int
+	for i := 0; i < 15; i++ {
+		var a, b bool
+		switch {
+		case i <= 5:
+			a = at(8, i)
+		case i == 6:
+			a = at(8, 7)
+		case i == 7:
+			a = at(8, 8)
+		case i == 8:
+			a = at(7, 8)
+		default:
+			a = at(14-i, 8)
+		}
+		if i < 8 {
+			b = at(size-1-i, 8)
+		} else {
+			b = at(8, size-15+i)
+		}
+		if a {
+			first |= 1 << i
+		}
+		if b {
+			second |= 1 << i
+		}
+	}
+	if first != second {
+		t.Fatalf("format copies differ: %015b and %015b", first, second)
+	}
+	format := first ^ 0x5412
+	rem := format >> 10
+	for i := 0; i < 10; i++ {
+		rem <<= 1
+		if rem&(1<<10) != 0 {
+			rem ^= 0x537
+		}
+	}
+	if rem != format&0x3FF {
+		t.Fatalf("format %015b has an invalid BCH code", format)
+	}
+	if format>>13 != 0 {
+		t.Fatalf("error correction level bits %02b, want M (00)", format>>13)
+	}
+	mask := format >> 10 & 7
+	if !at(8, size-8) {
+		t.Error("dark module is missing")
+	}
+
+	// Function modules: finders with separators and format areas, timing
+	// patterns and the one alignment pattern of versions 2 and 3
+	function := func(x, y int) bool {
+		switch {
+		case x <= 8 && y <= 8, x >= size-8 && y <= 8, x <= 8 && y >= size-8:
+			return true
+		case x == 6 || y == 6:
+			return true
+		case version > 1 && x >= size-9 && x <= size-5 && y >= size-9 && y <= size-5:
+			return true
+		}
+		return false
+	}
+	masked := func(x, y int) bool {
+		i, j := y, x
+		switch mask {
+		case 0:
+			return (i+j)%2 == 0
+		case 1:
+			return i%2 == 0
+		case 2:
+			return j%3 == 0
+		case 3:
+			return (i+j)%3 == 0
+		case 4:
+			return (i/2+j/3)%2 == 0
+		case 5:
+			return i*j%2+i*j%3 == 0
+		case 6:
+			return (i*j%2+i*j%3)%2 == 0
+		default:
+			return ((i+j)%2+i*j%3)%2 == 0
+		}
+	}
+
+	var bits []bool
+	upward := true
+	for right := size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for n := 0; n < size; n++ {
+			y := n
+			if upward {
+				y = size - 1 - n
+			}
+			for _, x := range []int{right, right - 1} {
+				if !function(x, y) {
+					bits = append(bits, at(x, y) != masked(x, y))
+				}
+			}
+		}
+		upward = !upward
+	}
+
+	total := []int{26, 44, 70}[version-1]
+	ec := []int{10, 16, 26}[version-1]
+	codewords := make([]byte, total)
+	for i := range codewords {
+		for _, bit := range bits[8*i : 8*i+8] {
+			codewords[i] <<= 1
+			if bit {
+				codewords[i] |= 1
+			}
+		}
+	}
+
+	gf := newGF256()
+	for k := 0; k < ec; k++ {
+		var syndrome byte
+		for _, c := range codewords {
+			syndrome = gf.mul(syndrome, gf.exp[k]) ^ c
+		}
+		if syndrome != 0 {
+			t.Fatalf("syndrome %d is %d, want 0", k, syndrome)
+		}
+	}
+
+	data := codewords[:total-ec]
+	bit := func(i int) int { return int(data[i/8] >> (7 - i%8) & 1) }
+	read := func(pos, n int) (int, int) {
+		value := 0
+		for i := 0; i < n; i++ {
+			value = value<<1 | bit(pos+i)
+		}
+		return value, pos + n
+	}
+	mode, pos := read(0, 4)
+	if mode != 0x4 {
+		t.Fatalf("mode %04b, want byte mode", mode)
+	}
+	length, pos := read(pos, 8)
+	payload := make([]byte, length)
+	for i := range payload {
+		var b int
+		b, pos = read(pos, 8)
+		payload[i] = byte(b)
+	}
+	return string(payload)
+}
+
+func TestQREncode(t *testing.T) {
+	tests := []struct {
+		data string
+		size int
+	}{
+		{data: "A", size: 21},
+		{data: "PDM part 42", size: 21},
+		{data: "https://pdm.example/p/42", size: 25},
+		{data: "https://pdm.example/parts/1234567890", size: 29},
+	}
+	for _, tt := range tests {
+		modules, err := qrEncode(tt.data)
+		if err != nil {
+			t.Errorf("qrEncode(%q): %v", tt.data, err)
+			continue
+		}
+		if len(modules) != tt.size {
+			t.Errorf("qrEncode(%q) size = %d, want %d", tt.data, len(modules), tt.size)
+			continue
+		}
+		if got := qrDecodeSingleBlock(t, modules); got != tt.data {
+			t.Errorf("qrEncode(%q) decodes to %q", tt.data, got)
+		}
+	}
+
+	if _, err := qrEncode(strings.Repeat("x", 214)); err == nil {
+		t.Error("qrEncode of 214 bytes succeeded, want an error")
+	}
+	modules, err := qrEncode(strings.Repeat("x", 213))
+	if err != nil {
+		t.Fatalf("qrEncode of 213 bytes: %v", err)
+	}
+	if len(modules) != 57 {
+		t.Errorf("qrEncode of 213 bytes size = %d, want 57 (version 10)", len(modules))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Broker is an in-process message broker: it fans outbox events out to
+// subscribers in this API instance. Subscribers that fall too far behind are
+// dropped, and their channel is closed so that they can catch up from the
+// outbox.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[*BrokerSubscription]struct{}
+}
+
+// BrokerSubscription receives the events its filter accepts on C until it is
+// closed by Close or dropped by the broker.
+type BrokerSubscription struct {
+	C      <-chan Event
+	ch     chan Event
+	filter func(Event) bool
+	broker *Broker
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[*BrokerSubscription]struct{}{}}
+}
+
+func (b *Broker) Name() string { return "broker" }
+
+// Publish hands the event to every matching subscriber without blocking.
+func (b *Broker) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscription := range b.subscribers {
+		if subscription.filter != nil && !subscription.filter(event) {
+			continue
+		}
+		select {
+		case subscription.ch <- event:
+		default:
+			delete(b.subscribers, subscription)
+			close(subscription.ch)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a subscription to events accepted by filter, or to every
+// event when filter is nil, buffering up to buffer events.
+func (b *Broker) Subscribe(filter func(Event) bool, buffer int) *BrokerSubscription {
+	ch := make(chan Event, buffer)
+	subscription := &BrokerSubscription{C: ch, ch: ch, filter: filter, broker: b}
+
+	b.mu.Lock()
+	b.subscribers[subscription] = struct{}{}
+	b.mu.Unlock()
+	return subscription
+}
+
+// Close ends the subscription. It is safe to call after the broker has
+// dropped it.
+func (s *BrokerSubscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	if _, ok := s.broker.subscribers[s]; ok {
+		delete(s.broker.subscribers, s)
+		close(s.ch)
+	}
+}
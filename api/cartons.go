@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// maxPackUnits limits the number of units in one packing request.
+const maxPackUnits = 500
+
+// Box is a shipping carton from the box catalog. Dimensions are inside
+// dimensions; MaxWeight of zero means no weight limit.
+type Box struct {
+	Name       string     `json:"name"`
+	Dimensions Dimensions `json:"dimensions"`
+	WeightUnit string     `json:"weight_unit"`
+	MaxWeight  float64    `json:"max_weight"`
+	TareWeight float64    `json:"tare_weight"`
+}
+
+type CartonizeRequest struct {
+	Carrier string      `json:"carrier"`
+	Items   []QuoteItem `json:"items"`
+}
+
+type PackedItem struct {
+	PartID   string `json:"part_id"`
+	Quantity int    `json:"quantity"`
+}
+
+type PackedBox struct {
+	Box               string       `json:"box"`
+	Dimensions        Dimensions   `json:"dimensions"`
+	Items             []PackedItem `json:"items"`
+	Weight            float64      `json:"weight_lb"`
+	DimensionalWeight float64      `json:"dimensional_weight_lb"`
+	Fragile           bool         `json:"fragile"`
+	Hazardous         bool         `json:"hazardous"`
+}
+
+type UnpackedItem struct {
+	PartID   string `json:"part_id"`
+	Quantity int    `json:"quantity"`
+	Reason   string `json:"reason"`
+}
+
+type PackingPlan struct {
+	DimDivisor             float64        `json:"dim_divisor"`
+	Boxes                  []PackedBox    `json:"boxes"`
+	BoxCount               int            `json:"box_count"`
+	TotalWeight            float64        `json:"total_weight_lb"`
+	TotalDimensionalWeight float64        `json:"total_dimensional_weight_lb"`
+	Unpacked               []UnpackedItem `json:"unpacked"`
+}
+
+// LoadBoxCatalog reads the box catalog from a JSON file holding an array of
+// Box.
+func LoadBoxCatalog(path string) ([]Box, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var boxes []Box
+	if err := json.Unmarshal(data, &boxes); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	for i := range boxes {
+		if err := boxes[i].validate(); err != nil {
+			return nil, fmt.Errorf("box %s: %v", boxes[i].Name, err)
+		}
+	}
+	return boxes, nil
+}
+
+func (b *Box) validate() error {
+	if b.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := b.Dimensions.validate(); err != nil {
+		return err
+	}
+	if b.WeightUnit == "" {
+		b.WeightUnit = DefaultWeightUnit
+	}
+	if _, ok := weightUnits[b.WeightUnit]; !ok {
+		return fmt.Errorf("invalid weight unit %q", b.WeightUnit)
+	}
+	if b.MaxWeight < 0 || b.TareWeight < 0 {
+		return fmt.Errorf("weights must not be negative")
+	}
+	return nil
+}
+
+// packUnit is one unit of a part, with its dimensions in inches sorted from
+// longest to shortest so it can be rotated to fit a box.
+type packUnit struct {
+	part   *Part
+	dims   [3]float64
+	volume float64
+	weight float64
+}
+
+// packedSet is the contents of one box while packing.
+type packedSet struct {
+	units  []packUnit
+	volume float64
+	weight float64
+}
+
+func sortedInches(d Dimensions) [3]float64 {
+	l, w, h := d.Inches()
+	dims := []float64{l, w, h}
+	sort.Sort(sort.Reverse(sort.Float64Slice(dims)))
+	return [3]float64{dims[0], dims[1], dims[2]}
+}
+
+// canShareBox reports whether two parts may be packed in the same box.
+// Fragile parts are only packed with fragile parts and hazardous parts only
+// with hazardous parts of compatible classes. Hazardous parts without a
+// classification are packed on their own.
+func canShareBox(a, b *Part) bool {
+	if a.Shipment.Fragile != b.Shipment.Fragile || a.Shipment.Hazardous != b.Shipment.Hazardous {
+		return false
+	}
+	if a.Shipment.Hazardous && a.ID != b.ID && (a.Shipment.Hazmat == nil || b.Shipment.Hazmat == nil) {
+		return false
+	}
+	return segregation(*a, *b) == ""
+}
+
+// holds reports whether the box can hold the units. The volume check assumes
+// units can fill the box without gaps, so the plan is a lower bound that
+// packers may need to adjust.
+func (b Box) holds(set packedSet) bool {
+	dims := sortedInches(b.Dimensions)
+	for _, unit := range set.units {
+		if unit.dims[0] > dims[0] || unit.dims[1] > dims[1] || unit.dims[2] > dims[2] {
+			return false
+		}
+	}
+	if set.volume > dims[0]*dims[1]*dims[2] {
+		return false
+	}
+	factor := weightUnits[b.WeightUnit]
+	return b.MaxWeight == 0 || set.weight+b.TareWeight*factor <= b.MaxWeight*factor
+}
+
+// bestBox returns the catalog box with the least dimensional weight, then the
+// least volume, that holds the units.
+func bestBox(boxes []Box, set packedSet, divisor float64) (Box, bool) {
+	var best Box
+	found := false
+	for _, box := range boxes {
+		if !box.holds(set) {
+			continue
+		}
+		if !found || box.Dimensions.DimWeightLb(divisor) < best.Dimensions.DimWeightLb(divisor) ||
+			box.Dimensions.DimWeightLb(divisor) == best.Dimensions.DimWeightLb(divisor) && boxVolume(box) < boxVolume(best) {
+			best, found = box, true
+		}
+	}
+	return best, found
+}
+
+func boxVolume(b Box) float64 {
+	l, w, h := b.Dimensions.Inches()
+	return l * w * h
+}
+
+// PackParts plans how to pack units of parts into catalog boxes. Units are
+// placed largest first into the first box they can share that some catalog
+// box still holds, which keeps the number of boxes low; each box is then the
+// catalog box with the least dimensional weight that holds its contents.
+func PackParts(boxes []Box, parts []Part, quantities []int, divisor float64) (PackingPlan, error) {
+	plan := PackingPlan{DimDivisor: divisor, Boxes: []PackedBox{}, Unpacked: []UnpackedItem{}}
+
+	// Count units before building them, so a huge quantity is rejected
+	// without allocating a unit for each
+	total := 0
+	for i := range parts {
+		if parts[i].Shipment.Dimensions == nil {
+			continue
+		}
+		if total += quantities[i]; total > maxPackUnits {
+			return PackingPlan{}, invalidf("at most %d units can be packed at once", maxPackUnits)
+		}
+	}
+
+	units := make([]packUnit, 0, total)
+	for i := range parts {
+		part := &parts[i]
+		if part.Shipment.Dimensions == nil {
+			plan.Unpacked = append(plan.Unpacked, UnpackedItem{PartID: part.ID, Quantity: quantities[i], Reason: "part has no dimensions"})
+			continue
+		}
+		unit := packUnit{part: part, dims: sortedInches(*part.Shipment.Dimensions), weight: part.Shipment.WeightLb()}
+		unit.volume = unit.dims[0] * unit.dims[1] * unit.dims[2]
+		for n := 0; n < quantities[i]; n++ {
+			units = append(units, unit)
+		}
+	}
+	sort.SliceStable(units, func(i, j int) bool {
+		if units[i].volume != units[j].volume {
+			return units[i].volume > units[j].volume
+		}
+		return units[i].weight > units[j].weight
+	})
+
+	var sets []packedSet
+	unpacked := map[*Part]int{}
+	for _, unit := range units {
+		placed := false
+		for i := range sets {
+			compatible := true
+			for _, packed := range sets[i].units {
+				if !canShareBox(packed.part, unit.part) {
+					compatible = false
+					break
+				}
+			}
+			if !compatible {
+				continue
+			}
+			candidate := packedSet{
+				units:  append(append([]packUnit{}, sets[i].units...), unit),
+				volume: sets[i].volume + unit.volume,
+				weight: sets[i].weight + unit.weight,
+			}
+			if _, ok := bestBox(boxes, candidate, divisor); ok {
+				sets[i] = candidate
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+
+		set := packedSet{units: []packUnit{unit}, volume: unit.volume, weight: unit.weight}
+		if _, ok := bestBox(boxes, set, divisor); !ok {
+			unpacked[unit.part]++
+			continue
+		}
+		sets = append(sets, set)
+	}
+
+	for i := range parts {
+		if n := unpacked[&parts[i]]; n > 0 {
+			plan.Unpacked = append(plan.Unpacked, UnpackedItem{PartID: parts[i].ID, Quantity: n, Reason: "no box in the catalog fits the part"})
+		}
+	}
+
+	for _, set := range sets {
+		box, _ := bestBox(boxes, set, divisor)
+		packed := PackedBox{
+			Box:               box.Name,
+			Dimensions:        box.Dimensions,
+			Weight:            math.Round((set.weight+box.TareWeight*weightUnits[box.WeightUnit])*100) / 100,
+			DimensionalWeight: box.Dimensions.DimWeightLb(divisor),
+			Fragile:           set.units[0].part.Shipment.Fragile,
+			Hazardous:         set.units[0].part.Shipment.Hazardous,
+		}
+		counts := map[string]int{}
+		for _, unit := range set.units {
+			if counts[unit.part.ID] == 0 {
+				packed.Items = append(packed.Items, PackedItem{PartID: unit.part.ID})
+			}
+			counts[unit.part.ID]++
+		}
+		for j := range packed.Items {
+			packed.Items[j].Quantity = counts[packed.Items[j].PartID]
+		}
+
+		plan.Boxes = append(plan.Boxes, packed)
+		plan.TotalWeight += packed.Weight
+		plan.TotalDimensionalWeight += packed.DimensionalWeight
+	}
+	plan.BoxCount = len(plan.Boxes)
+	plan.TotalWeight = math.Round(plan.TotalWeight*100) / 100
+	return plan, nil
+}
+
+// Cartonize Plans how to pack parts into boxes
+// @Summary      Plan cartons
+// @Description  Pack parts into catalog boxes, minimising boxes and dimensional weight
+// @Tags         /shipping/cartonize
+// @Accept       carrier, items
+// @Produce      packing plan
+func (r *Repository) Cartonize(ctx context.Context, boxes []Box, request CartonizeRequest) (PackingPlan, error) {
+	if len(request.Items) == 0 {
+		return PackingPlan{}, invalidf("items are required")
+	}
+
+	divisor := 0.0
+	if request.Carrier != "" {
+		var ok bool
+		if divisor, ok = dimDivisors[request.Carrier]; !ok {
+			return PackingPlan{}, invalidf("no dimensional weight divisor for carrier %s", request.Carrier)
+		}
+	} else {
+		// Without a carrier, use the divisor giving the highest dimensional weight.
+		for _, d := range dimDivisors {
+			if divisor == 0 || d < divisor {
+				divisor = d
+			}
+		}
+	}
+	if divisor == 0 {
+		return PackingPlan{}, fmt.Errorf("no dimensional weight divisors configured")
+	}
+
+	parts, err := r.getItemParts(ctx, request.Items)
+	if err != nil {
+		return PackingPlan{}, err
+	}
+	quantities := make([]int, len(request.Items))
+	for i, item := range request.Items {
+		quantities[i] = item.Quantity
+	}
+	return PackParts(boxes, parts, quantities, divisor)
+}
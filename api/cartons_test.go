@@ -0,0 +1,148 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testPart(id string, size float64, weight float64) Part {
+	return Part{ID: id, Name: "part " + id, Shipment: ShipmentInfo{
+		Weight:     weight,
+		WeightUnit: "lb",
+		Dimensions: &Dimensions{Length: size, Width: size, Height: size, Unit: "in"},
+	}}
+}
+
+func withShipment(part Part, edit func(*ShipmentInfo)) Part {
+	edit(&part.Shipment)
+	return part
+}
+
+func explosive(part Part) Part {
+	return withShipment(part, func(s *ShipmentInfo) {
+		s.Hazardous = true
+		s.Hazmat = &HazmatInfo{UNNumber: "UN0336", HazardClass: "1.4", SDSURL: "https://example.com/sds.pdf"}
+	})
+}
+
+func TestPackParts(t *testing.T) {
+	boxes := []Box{
+		{Name: "small", Dimensions: Dimensions{Length: 6, Width: 6, Height: 6, Unit: "in"}, WeightUnit: "lb", MaxWeight: 10},
+		{Name: "large", Dimensions: Dimensions{Length: 12, Width: 12, Height: 12, Unit: "in"}, WeightUnit: "lb", MaxWeight: 20},
+	}
+
+	tests := []struct {
+		name       string
+		parts      []Part
+		quantities []int
+		boxes      []string
+		items      [][]PackedItem
+		unpacked   []UnpackedItem
+		err        string
+	}{
+		{
+			name:       "units share the smallest box that holds them",
+			parts:      []Part{testPart("1", 3, 1)},
+			quantities: []int{2},
+			boxes:      []string{"small"},
+			items:      [][]PackedItem{{{PartID: "1", Quantity: 2}}},
+		},
+		{
+			name:       "a larger box when the small one is full",
+			parts:      []Part{testPart("1", 5, 1)},
+			quantities: []int{2},
+			boxes:      []string{"large"},
+			items:      [][]PackedItem{{{PartID: "1", Quantity: 2}}},
+		},
+		{
+			name:       "weight limit opens another box",
+			parts:      []Part{testPart("1", 2, 8)},
+			quantities: []int{3},
+			boxes:      []string{"large", "small"},
+			items:      [][]PackedItem{{{PartID: "1", Quantity: 2}}, {{PartID: "1", Quantity: 1}}},
+		},
+		{
+			name:       "fragile parts are packed apart",
+			parts:      []Part{testPart("1", 3, 1), withShipment(testPart("2", 3, 1), func(s *ShipmentInfo) { s.Fragile = true })},
+			quantities: []int{1, 1},
+			boxes:      []string{"small", "small"},
+			items:      [][]PackedItem{{{PartID: "1", Quantity: 1}}, {{PartID: "2", Quantity: 1}}},
+		},
+		{
+			name:       "units of one explosive share a box",
+			parts:      []Part{explosive(testPart("1", 2, 1))},
+			quantities: []int{3},
+			boxes:      []string{"small"},
+			items:      [][]PackedItem{{{PartID: "1", Quantity: 3}}},
+		},
+		{
+			name:       "different explosives are packed apart",
+			parts:      []Part{explosive(testPart("1", 2, 1)), explosive(testPart("2", 2, 1))},
+			quantities: []int{1, 1},
+			boxes:      []string{"small", "small"},
+			items:      [][]PackedItem{{{PartID: "1", Quantity: 1}}, {{PartID: "2", Quantity: 1}}},
+		},
+		{
+			name:       "parts without dimensions or too large are unpacked",
+			parts:      []Part{withShipment(testPart("1", 3, 1), func(s *ShipmentInfo) { s.Dimensions = nil }), testPart("2", 20, 1)},
+			quantities: []int{2, 3},
+			unpacked: []UnpackedItem{
+				{PartID: "1", Quantity: 2, Reason: "part has no dimensions"},
+				{PartID: "2", Quantity: 3, Reason: "no box in the catalog fits the part"},
+			},
+		},
+		{
+			name:       "too many units",
+			parts:      []Part{testPart("1", 1, 1), testPart("2", 1, 1)},
+			quantities: []int{maxPackUnits, 1},
+			err:        "at most",
+		},
+		{
+			name:       "huge quantity is rejected before packing",
+			parts:      []Part{testPart("1", 1, 1)},
+			quantities: []int{2000000000},
+			err:        "at most",
+		},
+		{
+			name:       "units without dimensions do not count towards the limit",
+			parts:      []Part{withShipment(testPart("1", 1, 1), func(s *ShipmentInfo) { s.Dimensions = nil })},
+			quantities: []int{2000000000},
+			unpacked:   []UnpackedItem{{PartID: "1", Quantity: 2000000000, Reason: "part has no dimensions"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PackParts(boxes, tt.parts, tt.quantities, 139)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			var items [][]PackedItem
+			for _, box := range plan.Boxes {
+				names = append(names, box.Box)
+				items = append(items, box.Items)
+			}
+			if !reflect.DeepEqual(names, tt.boxes) || !reflect.DeepEqual(items, tt.items) {
+				t.Errorf("boxes = %v %v, want %v %v", names, items, tt.boxes, tt.items)
+			}
+			if plan.BoxCount != len(tt.boxes) {
+				t.Errorf("box count = %d, want %d", plan.BoxCount, len(tt.boxes))
+			}
+			if len(tt.unpacked) == 0 {
+				tt.unpacked = []UnpackedItem{}
+			}
+			if !reflect.DeepEqual(plan.Unpacked, tt.unpacked) {
+				t.Errorf("unpacked = %v, want %v", plan.Unpacked, tt.unpacked)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sort"
+)
+
+// CostComponent is an additional landed cost of a part, such as freight or duty.
+type CostComponent struct {
+	Name   string `json:"name"`
+	Amount Money  `json:"amount"`
+}
+
+// Margin is computed from the price and landed cost of a part when it is read;
+// it is never stored.
+type Margin struct {
+	LandedCost    Money  `json:"landed_cost"`
+	Margin        Money  `json:"margin"`
+	MarginPercent string `json:"margin_percent,omitempty"`
+	MarkupPercent string `json:"markup_percent,omitempty"`
+}
+
+type MarginGroup struct {
+	Group            string `json:"group"`
+	Parts            int    `json:"parts"`
+	PartsWithoutCost int    `json:"parts_without_cost"`
+	Revenue          Money  `json:"revenue"`
+	LandedCost       Money  `json:"landed_cost"`
+	Margin           Money  `json:"margin"`
+	MarginPercent    string `json:"margin_percent,omitempty"`
+	MarkupPercent    string `json:"markup_percent,omitempty"`
+}
+
+func (p Part) validateCosts() error {
+	if p.Cost == nil {
+		if len(p.LandedCosts) > 0 {
+			return invalidf("landed costs require a cost")
+		}
+		return nil
+	}
+	if p.Cost.Cents < 0 {
+		return invalidf("cost must not be negative")
+	}
+	for _, component := range p.LandedCosts {
+		if component.Name == "" {
+			return invalidf("landed cost components must be named")
+		}
+		if component.Amount.Cents < 0 {
+			return invalidf("landed cost %q must not be negative", component.Name)
+		}
+		if component.Amount.Currency != p.Cost.Currency {
+			return invalidf("landed cost %q must be in the cost currency %s", component.Name, p.Cost.Currency)
+		}
+	}
+	return nil
+}
+
+// landedCost returns the cost plus every landed-cost component, or false
+// when the part has no cost.
+func (p Part) landedCost() (Money, bool) {
+	if p.Cost == nil {
+		return Money{}, false
+	}
+	total := *p.Cost
+	for _, component := range p.LandedCosts {
+		total.Cents += component.Amount.Cents
+	}
+	return total, true
+}
+
+// percentOf formats part / whole * 100 with two decimals, or "" when whole is zero.
+func percentOf(part, whole Money) string {
+	if whole.Cents == 0 {
+		return ""
+	}
+	ratio := new(big.Rat).Quo(part.Rat(), whole.Rat())
+	return ratio.Mul(ratio, big.NewRat(100, 1)).FloatString(2)
+}
+
+// computeMargin sets p.Margin, converting the landed cost into the price
+// currency when they differ. The margin is left out when there is no cost or
+// no exchange rate to compare it with the price.
+func (p *Part) computeMargin(table RateTable) {
+	p.Margin = nil
+	landed, ok := p.landedCost()
+	if !ok {
+		return
+	}
+	landed, err := table.Convert(landed, p.Price.Currency)
+	if err != nil {
+		return
+	}
+
+	margin := Money{Cents: p.Price.Cents - landed.Cents, Currency: p.Price.Currency}
+	p.Margin = &Margin{
+		LandedCost:    landed,
+		Margin:        margin,
+		MarginPercent: percentOf(margin, p.Price),
+		MarkupPercent: percentOf(margin, landed),
+	}
+}
+
+// ApplyCostVisibility computes the margin of every part when costs are
+// visible to the caller, and strips all cost data otherwise.
+func (r *Repository) ApplyCostVisibility(ctx context.Context, parts []Part, visible bool) error {
+	if !visible {
+		for i := range parts {
+			parts[i].Cost, parts[i].LandedCosts, parts[i].Margin = nil, nil, nil
+		}
+		return nil
+	}
+
+	var table RateTable
+	for i := range parts {
+		if parts[i].Cost != nil && parts[i].Cost.Currency != parts[i].Price.Currency && table == nil {
+			var err error
+			if table, err = r.RateTable(ctx); err != nil {
+				return err
+			}
+		}
+		parts[i].computeMargin(table)
+	}
+	return nil
+}
+
+// MarginReport Reports margins grouped by location or attribute
+// @Summary      Margin report
+// @Description  Sum revenue, landed cost and margin per location or attribute value
+// @Tags         /reports/margins
+// @Accept       group by, attribute, currency
+// @Produce      margin groups
+func (r *Repository) MarginReport(ctx context.Context, groupBy, attribute, currency string) ([]MarginGroup, error) {
+	if groupBy != "location" && groupBy != "attribute" {
+		return nil, invalidf("group_by must be location or attribute")
+	}
+	if groupBy == "attribute" && attribute == "" {
+		return nil, invalidf("attribute is required when grouping by attribute")
+	}
+	if currency == "" {
+		currency = BaseCurrency
+	}
+
+	parts, err := r.ListParts(ctx, PartFilter{})
+	if err != nil {
+		return nil, err
+	}
+	table, err := r.RateTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]*MarginGroup{}
+	for _, part := range parts {
+		key := part.Location
+		if groupBy == "attribute" {
+			key = part.Attributes[attribute]
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &MarginGroup{
+				Group:      key,
+				Revenue:    Money{Currency: currency},
+				LandedCost: Money{Currency: currency},
+				Margin:     Money{Currency: currency},
+			}
+			groups[key] = group
+		}
+		group.Parts++
+
+		landed, ok := part.landedCost()
+		if !ok {
+			group.PartsWithoutCost++
+			continue
+		}
+		price, err := table.Convert(part.Price, currency)
+		if err != nil {
+			return nil, err
+		}
+		landed, err = table.Convert(landed, currency)
+		if err != nil {
+			return nil, err
+		}
+		group.Revenue.Cents += price.Cents
+		group.LandedCost.Cents += landed.Cents
+		group.Margin.Cents += price.Cents - landed.Cents
+	}
+
+	report := []MarginGroup{}
+	for _, group := range groups {
+		group.MarginPercent = percentOf(group.Margin, group.Revenue)
+		group.MarkupPercent = percentOf(group.Margin, group.LandedCost)
+		report = append(report, *group)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Group < report[j].Group })
+	return report, nil
+}
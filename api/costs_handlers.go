@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Margin report Handler
+func MarginReportHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hasPermission(r, PermViewCost) {
+			http.Error(w, "not allowed to view costs", http.StatusForbidden)
+			return
+		}
+
+		q := r.URL.Query()
+		report, err := repository.MarginReport(r.Context(), q.Get("group_by"), q.Get("attribute"), q.Get("currency"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
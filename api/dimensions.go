@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultWeightUnit is assumed for weights stored before units were recorded.
+const DefaultWeightUnit = "lb"
+
+// lengthUnits and weightUnits give the size of each unit in inches and pounds.
+var lengthUnits = map[string]float64{
+	"in": 1,
+	"ft": 12,
+	"mm": 1 / 25.4,
+	"cm": 1 / 2.54,
+	"m":  100 / 2.54,
+}
+
+var weightUnits = map[string]float64{
+	"lb": 1,
+	"oz": 1.0 / 16,
+	"kg": 1 / 0.45359237,
+	"g":  1 / 453.59237,
+}
+
+// dimDivisors maps a carrier to its dimensional-weight divisor in cubic
+// inches per pound. They can be overridden with DIM_DIVISORS.
+var dimDivisors = map[string]float64{
+	"fedex": 139,
+	"ups":   139,
+	"usps":  166,
+}
+
+type Dimensions struct {
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Unit   string  `json:"unit"`
+}
+
+type DimWeight struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// sizePattern matches sizes such as "10x8x4 in", "10 x 8 x 4in" or
+// `10" x 8" x 4"`.
+var sizePattern = regexp.MustCompile(`(?i)^\s*([0-9]*\.?[0-9]+)\s*(?:"|in)?\s*[x×*]\s*([0-9]*\.?[0-9]+)\s*(?:"|in)?\s*[x×*]\s*([0-9]*\.?[0-9]+)\s*("|[a-zA-Z]+)?\s*$`)
+
+// ParseSize parses a free-text package size into Dimensions. The unit is
+// required, except that inch marks are read as inches.
+func ParseSize(size string) (Dimensions, error) {
+	m := sizePattern.FindStringSubmatch(size)
+	if m == nil {
+		return Dimensions{}, invalidf("unrecognised size %q", size)
+	}
+
+	unit := strings.ToLower(m[4])
+	switch unit {
+	case `"`, "inch", "inches":
+		unit = "in"
+	case "":
+		if !strings.Contains(size, `"`) {
+			return Dimensions{}, invalidf("size %q has no unit", size)
+		}
+		unit = "in"
+	}
+
+	var values [3]float64
+	for i := range values {
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return Dimensions{}, invalidf("unrecognised size %q", size)
+		}
+		values[i] = v
+	}
+
+	d := Dimensions{Length: values[0], Width: values[1], Height: values[2], Unit: unit}
+	if err := d.validate(); err != nil {
+		return Dimensions{}, err
+	}
+	return d, nil
+}
+
+func (d Dimensions) validate() error {
+	if _, ok := lengthUnits[d.Unit]; !ok {
+		return invalidf("invalid length unit %q", d.Unit)
+	}
+	if d.Length <= 0 || d.Width <= 0 || d.Height <= 0 {
+		return invalidf("dimensions must be positive")
+	}
+	return nil
+}
+
+// String formats the dimensions the way sizes were entered by hand.
+func (d Dimensions) String() string {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return fmt.Sprintf("%sx%sx%s %s", format(d.Length), format(d.Width), format(d.Height), d.Unit)
+}
+
+// Inches returns the dimensions converted to inches.
+func (d Dimensions) Inches() (float64, float64, float64) {
+	f := lengthUnits[d.Unit]
+	return d.Length * f, d.Width * f, d.Height * f
+}
+
+// WeightLb returns the shipment weight in pounds.
+func (s ShipmentInfo) WeightLb() float64 {
+	unit := s.WeightUnit
+	if unit == "" {
+		unit = DefaultWeightUnit
+	}
+	return s.Weight * weightUnits[unit]
+}
+
+// normalize fills in structured dimensions from Size (or Size from the
+// dimensions) and checks the units and hazmat data. A Size that cannot be parsed is kept as
+// free text.
+func (s *ShipmentInfo) normalize() error {
+	if s.WeightUnit == "" {
+		s.WeightUnit = DefaultWeightUnit
+	}
+	if _, ok := weightUnits[s.WeightUnit]; !ok {
+		return invalidf("invalid weight unit %q", s.WeightUnit)
+	}
+	if s.Weight < 0 {
+		return invalidf("weight must not be negative")
+	}
+	if s.Hazmat != nil {
+		if err := s.Hazmat.normalize(); err != nil {
+			return err
+		}
+		s.Hazardous = true
+	}
+
+	if s.Dimensions == nil {
+		if d, err := ParseSize(s.Size); err == nil {
+			s.Dimensions = &d
+		}
+		return nil
+	}
+	if err := s.Dimensions.validate(); err != nil {
+		return err
+	}
+	if s.Size == "" {
+		s.Size = s.Dimensions.String()
+	}
+	return nil
+}
+
+// computeDimensionalWeight sets the dimensional weight for every configured
+// carrier.
+func (s *ShipmentInfo) computeDimensionalWeight() {
+	s.DimensionalWeight = nil
+	if s.Dimensions == nil {
+		return
+	}
+
+	s.DimensionalWeight = map[string]DimWeight{}
+	for carrier, divisor := range dimDivisors {
+		s.DimensionalWeight[carrier] = DimWeight{Value: s.Dimensions.DimWeightLb(divisor), Unit: "lb"}
+	}
+}
+
+// DimWeightLb returns the dimensional weight in pounds for a divisor in cubic
+// inches per pound, rounding each dimension up to a whole inch and the result
+// up to a whole pound.
+func (d Dimensions) DimWeightLb(divisor float64) float64 {
+	l, w, h := d.Inches()
+	return math.Ceil(math.Ceil(l) * math.Ceil(w) * math.Ceil(h) / divisor)
+}
+
+// parseDimDivisors parses a DIM_DIVISORS value such as "ups=139,usps=166".
+func parseDimDivisors(value string) (map[string]float64, error) {
+	divisors := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		carrier, divisor, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid divisor %q", pair)
+		}
+		d, err := strconv.ParseFloat(divisor, 64)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid divisor %q", pair)
+		}
+		divisors[strings.ToLower(strings.TrimSpace(carrier))] = d
+	}
+	return divisors, nil
+}
+
+type DimensionMigration struct {
+	Migrated int           `json:"migrated"`
+	Skipped  []SkippedSize `json:"skipped"`
+}
+
+type SkippedSize struct {
+	PartID string `json:"part_id"`
+	Size   string `json:"size"`
+	Reason string `json:"reason"`
+}
+
+// MigrateShipmentDimensions parses the free-text Size of every part and
+// version that has no structured dimensions yet, and records the weight unit
+// of weights stored without one. Sizes that cannot be parsed are reported and
+// left unchanged.
+func (r *Repository) MigrateShipmentDimensions(ctx context.Context) (DimensionMigration, error) {
+	migration := DimensionMigration{Skipped: []SkippedSize{}}
+	tables := []struct{ name, rowID, partID string }{
+		{"parts", "id", "id"},
+		{"part_versions", "version_id", "part_id"},
+	}
+	for _, table := range tables {
+		rows, err := r.db.QueryContext(ctx, `SELECT `+table.rowID+`, `+table.partID+`, shipment FROM `+table.name)
+		if err != nil {
+			return DimensionMigration{}, err
+		}
+
+		type update struct {
+			rowID    int64
+			shipment ShipmentInfo
+			parsed   bool
+		}
+		var updates []update
+		for rows.Next() {
+			var rowID int64
+			var partID string
+			var raw []byte
+			if err := rows.Scan(&rowID, &partID, &raw); err != nil {
+				rows.Close()
+				return DimensionMigration{}, err
+			}
+
+			var shipment ShipmentInfo
+			if raw != nil {
+				if err := json.Unmarshal(raw, &shipment); err != nil {
+					rows.Close()
+					return DimensionMigration{}, err
+				}
+			}
+			needsDimensions := shipment.Dimensions == nil && shipment.Size != ""
+			if !needsDimensions && shipment.WeightUnit != "" {
+				continue
+			}
+			parsed := false
+			if needsDimensions {
+				d, err := ParseSize(shipment.Size)
+				if err != nil {
+					if table.name == "parts" {
+						migration.Skipped = append(migration.Skipped, SkippedSize{PartID: partID, Size: shipment.Size, Reason: err.Error()})
+					}
+				} else {
+					shipment.Dimensions = &d
+					parsed = true
+				}
+			}
+			if shipment.WeightUnit == "" {
+				shipment.WeightUnit = DefaultWeightUnit
+			}
+			updates = append(updates, update{rowID: rowID, shipment: shipment, parsed: parsed})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return DimensionMigration{}, err
+		}
+
+		for _, u := range updates {
+			raw, err := json.Marshal(u.shipment)
+			if err != nil {
+				return DimensionMigration{}, err
+			}
+			if _, err := r.db.ExecContext(ctx, `UPDATE `+table.name+` SET shipment = ? WHERE `+table.rowID+` = ?`, raw, u.rowID); err != nil {
+				return DimensionMigration{}, err
+			}
+			if table.name == "parts" && u.parsed {
+				migration.Migrated++
+			}
+		}
+	}
+
+	sort.Slice(migration.Skipped, func(i, j int) bool { return migration.Skipped[i].PartID < migration.Skipped[j].PartID })
+	return migration, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errNotFound is wrapped by the errors for a missing entity, such as
+// fmt.Errorf("part %w", errNotFound), which reads "part not found".
+var errNotFound = errors.New("not found")
+
+// errForbidden is wrapped by the errors for something the caller's role may
+// not see or do, such as fmt.Errorf("%w to view costs", errForbidden).
+var errForbidden = errors.New("not allowed")
+
+// validationError is a problem with a request's input. Its message is
+// meant for the client, unlike that of any other error.
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string { return e.err.Error() }
+
+func (e *validationError) Unwrap() error { return e.err }
+
+// invalidf returns a validation error with a formatted message.
+func invalidf(format string, args ...interface{}) error {
+	return &validationError{err: fmt.Errorf(format, args...)}
+}
+
+// isDuplicateKey reports whether err is MySQL's error for a row that breaks
+// a unique key.
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// writeError answers a request that failed with err: 404 for a missing
+// entity, 403 for a forbidden one, 400 for invalid input, all with the
+// error's message, and 500 without it for anything else.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *validationError
+	switch {
+	case errors.Is(err, errNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.As(err, &invalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		internalError(w, r, err)
+	}
+}
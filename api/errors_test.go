@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{name: "not found", err: fmt.Errorf("part %w", errNotFound), status: http.StatusNotFound, body: "part not found"},
+		{name: "no rows", err: sql.ErrNoRows, status: http.StatusNotFound, body: "not found"},
+		{name: "forbidden", err: fmt.Errorf("%w to view costs", errForbidden), status: http.StatusForbidden, body: "not allowed to view costs"},
+		{name: "validation", err: invalidf("quantity must be at least %d", 1), status: http.StatusBadRequest, body: "quantity must be at least 1"},
+		{name: "wrapped validation", err: fmt.Errorf("box: %w", invalidf("weights must not be negative")), status: http.StatusBadRequest, body: "box: weights must not be negative"},
+		{name: "driver error", err: &mysql.MySQLError{Number: 1146, Message: "Table 'pdm.parts' doesn't exist"}, status: http.StatusInternalServerError, body: "internal server error"},
+		{name: "other error", err: errors.New("dial tcp 10.0.0.5:3306: connection refused"), status: http.StatusInternalServerError, body: "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest(http.MethodGet, "/parts/1", nil), tt.err)
+			body := strings.TrimSpace(w.Body.String())
+			if w.Code != tt.status || body != tt.body {
+				t.Errorf("writeError(%v) = %d %q, want %d %q", tt.err, w.Code, body, tt.status, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Part lifecycle event types.
+const (
+	EventPartCreated     = "part.created"
+	EventPartUpdated     = "part.updated"
+	EventPartDeleted     = "part.deleted"
+	EventVersionRestored = "version.restored"
+)
+
+var eventTypes = map[string]bool{
+	EventPartCreated:     true,
+	EventPartUpdated:     true,
+	EventPartDeleted:     true,
+	EventVersionRestored: true,
+}
+
+// Event describes a change to a part. Part is the part after the change,
+// without costs, and is omitted for deletions. Location is the part's
+// location after the change, or before it for deletions. Seq is the event's
+// position in the outbox.
+type Event struct {
+	Seq          int64  `json:"seq,omitempty"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	OccurredAt   string `json:"occurred_at"`
+	PartID       string `json:"part_id"`
+	Location     string `json:"location,omitempty"`
+	Version      int    `json:"version,omitempty"`
+	RestoredFrom int    `json:"restored_from,omitempty"`
+	Actor        string `json:"actor,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	Part         *Part  `json:"part,omitempty"`
+}
+
+// newPartEvent builds an event for a part that has just changed, reading
+// its state in the transaction that changed it. Change carries the author
+// and request ID, and for deletions the location of the deleted part.
+func newPartEvent(ctx context.Context, q sqlExecutor, eventType, partID string, change Part, restoredFrom int) (Event, error) {
+	id, err := randomHex(12)
+	if err != nil {
+		return Event{}, err
+	}
+	event := Event{
+		ID:           "evt_" + id,
+		Type:         eventType,
+		OccurredAt:   time.Now().UTC().Format(time.RFC3339Nano),
+		PartID:       partID,
+		RestoredFrom: restoredFrom,
+		Actor:        change.Author,
+		RequestID:    change.RequestID,
+	}
+	if eventType == EventPartDeleted {
+		event.Location = change.Location
+		return event, nil
+	}
+
+	part, err := getPart(ctx, q, partID)
+	if err != nil {
+		return Event{}, err
+	}
+	event.Version = part.Version
+	event.Location = part.Location
+	part.Cost, part.LandedCosts, part.Margin = nil, nil, nil
+	event.Part = &part
+	return event, nil
+}
+
+// appendPartEvent writes the event for a change to the outbox, in the same
+// transaction as the change, so that it is published if and only if the
+// change is committed. It must be the transaction's last statement, since
+// the outbox lock it takes blocks every other change until the commit.
+func appendPartEvent(ctx context.Context, tx *sql.Tx, eventType, partID string, change Part, restoredFrom int) error {
+	event, err := newPartEvent(ctx, tx, eventType, partID, change, restoredFrom)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// Wait for other writers to commit, so that outbox IDs commit in order
+	var lock int
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM outbox_lock WHERE id = 1 FOR UPDATE`).Scan(&lock); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO outbox (event_id, event_type, part_id, payload, created_at) VALUES (?, ?, ?, ?, ?)`,
+		event.ID, event.Type, event.PartID, payload, time.Now().UTC())
+	return err
+}
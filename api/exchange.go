@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// maxExchangeRate is the first rate too large for the ten integer digits of
+// the rate column.
+var maxExchangeRate = big.NewRat(10_000_000_000, 1)
+
+type ExchangeRate struct {
+	Currency  string `json:"currency"`
+	Rate      string `json:"rate"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// ListExchangeRates List exchange rates from db
+// @Summary      List exchange rates
+// @Description  List units of each currency per one unit of the base currency
+// @Tags         /exchange-rates
+// @Produce      exchange rates
+func (r *Repository) ListExchangeRates(ctx context.Context) ([]ExchangeRate, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT currency, rate, updated_at FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// SetExchangeRate Sets the exchange rate of a currency
+// @Summary      Set exchange rate
+// @Description  Set units of a currency per one unit of the base currency
+// @Tags         /exchange-rates/{currency}
+// @Accept       currency, rate
+// @Produce      exchange rate
+func (r *Repository) SetExchangeRate(ctx context.Context, currency, rate string) (ExchangeRate, error) {
+	if !validCurrency(currency) || currency == BaseCurrency {
+		return ExchangeRate{}, invalidf("invalid currency %q", currency)
+	}
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok || value.Sign() <= 0 {
+		return ExchangeRate{}, invalidf("invalid rate %q", rate)
+	}
+	// Rates are stored in DECIMAL(18, 8), so check what is left after rounding
+	stored := value.FloatString(8)
+	value.SetString(stored)
+	if value.Sign() == 0 {
+		return ExchangeRate{}, invalidf("rate %q rounds to zero at 8 decimal places", rate)
+	}
+	if value.Cmp(maxExchangeRate) >= 0 {
+		return ExchangeRate{}, invalidf("rate %q must be below %s", rate, maxExchangeRate.FloatString(0))
+	}
+
+	updatedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	query := `
+		INSERT INTO exchange_rates (currency, rate, updated_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE rate = VALUES(rate), updated_at = VALUES(updated_at)
+	`
+	if _, err := r.db.ExecContext(ctx, query, currency, stored, updatedAt); err != nil {
+		return ExchangeRate{}, err
+	}
+	return ExchangeRate{Currency: currency, Rate: stored, UpdatedAt: updatedAt}, nil
+}
+
+// RateTable loads every exchange rate for converting prices.
+func (r *Repository) RateTable(ctx context.Context) (RateTable, error) {
+	rates, err := r.ListExchangeRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	table := RateTable{}
+	for _, rate := range rates {
+		value, ok := new(big.Rat).SetString(rate.Rate)
+		if !ok {
+			return nil, fmt.Errorf("invalid stored rate for %s", rate.Currency)
+		}
+		table[rate.Currency] = value
+	}
+	return table, nil
+}
+
+// ConvertPrices converts the price and costs of every part into currency in place. An
+// empty currency leaves the prices untouched.
+func (r *Repository) ConvertPrices(ctx context.Context, parts []Part, currency string) error {
+	if currency == "" {
+		return nil
+	}
+	if !validCurrency(currency) {
+		return invalidf("invalid currency %q", currency)
+	}
+
+	table, err := r.RateTable(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range parts {
+		converted, err := table.Convert(parts[i].Price, currency)
+		if err != nil {
+			return err
+		}
+		parts[i].Price = converted
+
+		if parts[i].Cost != nil {
+			cost, err := table.Convert(*parts[i].Cost, currency)
+			if err != nil {
+				return err
+			}
+			parts[i].Cost = &cost
+		}
+		for j, component := range parts[i].LandedCosts {
+			amount, err := table.Convert(component.Amount, currency)
+			if err != nil {
+				return err
+			}
+			parts[i].LandedCosts[j].Amount = amount
+		}
+	}
+	return nil
+}
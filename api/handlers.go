@@ -2,12 +2,27 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
+// stampChange records who made a change to a part and in which request. The
+// change comment is left as the client sent it. Changes made without a
+// principal, when authentication is disabled, are by "anonymous" as in the
+// audit log.
+func stampChange(r *http.Request, part *Part) {
+	part.Author, part.RequestID = "anonymous", requestIDFromContext(r.Context())
+	if principal, ok := principalFromContext(r.Context()); ok {
+		part.Author = principal.Name
+		if part.Author == "" {
+			part.Author = principal.Subject
+		}
+	}
+}
+
 // Function to Create Part
 func CreatePartHandler(repository *Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -17,9 +32,15 @@ func CreatePartHandler(repository *Repository) http.HandlerFunc {
 			return
 		}
 
-		id, err := repository.CreatePart(part)
+		if !hasPermission(r, PermViewCost) {
+			part.Cost, part.LandedCosts = nil, nil
+		}
+		part.Margin = nil
+		stampChange(r, &part)
+
+		id, err := repository.CreatePart(r.Context(), part)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -34,11 +55,18 @@ func CreatePartHandler(repository *Repository) http.HandlerFunc {
 func GetPartHandler(repository *Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
-		part, err := repository.GetPart(id)
+		part, err := repository.GetPart(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
+			return
+		}
+
+		parts := []Part{part}
+		if err := presentParts(repository, r, parts); err != nil {
+			writeError(w, r, err)
 			return
 		}
+		part = parts[0]
 
 		json.NewEncoder(w).Encode(part)
 	}
@@ -46,9 +74,20 @@ func GetPartHandler(repository *Repository) http.HandlerFunc {
 
 func ListPartsHandler(repository *Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		parts, err := repository.ListParts()
+		filter, err := parseInStock(r.URL.Query().Get("in_stock"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		parts, err := repository.ListParts(r.Context(), filter)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			internalError(w, r, err)
+			return
+		}
+
+		if err := presentParts(repository, r, parts); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -67,8 +106,39 @@ func UpdatePartHandler(repository *Repository) http.HandlerFunc {
 			return
 		}
 
-		if err := repository.UpdatePart(id, part); err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		// Callers who cannot see costs keep the existing ones rather than clearing them
+		if !hasPermission(r, PermViewCost) {
+			existingPart, err := repository.GetPart(r.Context(), id)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			part.Cost, part.LandedCosts = existingPart.Cost, existingPart.LandedCosts
+		}
+		stampChange(r, &part)
+
+		// Edits from an older version are merged with the changes saved since
+		if part.BaseVersion > 0 {
+			saved, err := repository.UpdatePartFromVersion(r.Context(), id, part, part.BaseVersion)
+			var conflict *VersionConflict
+			if errors.As(err, &conflict) {
+				writeVersionConflict(w, r, conflict)
+				return
+			} else if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			if !hasPermission(r, PermViewCost) {
+				saved.Cost, saved.LandedCosts = nil, nil
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(saved)
+			return
+		}
+
+		if err := repository.UpdatePart(r.Context(), id, part); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -82,9 +152,9 @@ func PatchPartHandler(repository *Repository) http.HandlerFunc {
 		id := mux.Vars(r)["id"]
 
 		// Get the existing part to update it
-		existingPart, err := repository.GetPart(id)
+		existingPart, err := repository.GetPart(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 
@@ -96,11 +166,32 @@ func PatchPartHandler(repository *Repository) http.HandlerFunc {
 
 		// Apply updates to the existing part
 		for key, value := range updates {
+			if (key == "cost" || key == "landed_costs") && !hasPermission(r, PermViewCost) {
+				http.Error(w, "not allowed to change costs", http.StatusForbidden)
+				return
+			}
+
 			switch key {
 			case "name":
 				existingPart.Name = value.(string)
 			case "price":
-				existingPart.Price = value.(float64)
+				raw, _ := json.Marshal(value)
+				if err := json.Unmarshal(raw, &existingPart.Price); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			case "cost":
+				raw, _ := json.Marshal(value)
+				if err := json.Unmarshal(raw, &existingPart.Cost); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			case "landed_costs":
+				raw, _ := json.Marshal(value)
+				if err := json.Unmarshal(raw, &existingPart.LandedCosts); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
 			case "description":
 				existingPart.Description = value.(string)
 			case "attributes":
@@ -117,11 +208,14 @@ func PatchPartHandler(repository *Repository) http.HandlerFunc {
 				existingPart.Shipment = value.(ShipmentInfo)
 			case "metadata":
 				existingPart.Metadata = value.(map[string]string)
+			case "change_comment":
+				existingPart.ChangeComment, _ = value.(string)
 			}
 		}
+		stampChange(r, &existingPart)
 
-		if err := repository.UpdatePart(id, existingPart); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := repository.UpdatePart(r.Context(), id, existingPart); err != nil {
+			writeError(w, r, err)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -132,8 +226,10 @@ func PatchPartHandler(repository *Repository) http.HandlerFunc {
 func DeletePartHandler(repository *Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
-		if err := repository.DeletePart(id); err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		var change Part
+		stampChange(r, &change)
+		if err := repository.DeletePart(r.Context(), id, change); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -151,23 +247,58 @@ func GetPartVersionHandler(repository *Repository) http.HandlerFunc {
 			return
 		}
 
-		part, err := repository.GetPartVersion(id, version)
+		part, err := repository.GetPartVersion(r.Context(), id, version)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
+			return
+		}
+
+		parts := []Part{part}
+		if err := presentParts(repository, r, parts); err != nil {
+			writeError(w, r, err)
 			return
 		}
+		part = parts[0]
 
 		json.NewEncoder(w).Encode(part)
 	}
 }
 
+// Restore Part version Handler
+func RestorePartVersionHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		version, err := strconv.Atoi(mux.Vars(r)["version"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var change Part
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		stampChange(r, &change)
+
+		if err := repository.RestorePartVersion(r.Context(), id, version, change, hasPermission(r, PermViewCost)); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 // List Part version Handler
 func ListPartVersionsHandler(repository *Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
-		versions, err := repository.ListPartVersions(id)
+		versions, err := repository.ListPartVersions(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 
@@ -183,9 +314,20 @@ func SearchPartsHandler(repository *Repository) http.HandlerFunc {
 			return
 		}
 
-		parts, err := repository.SearchParts(query)
+		filter, err := parseInStock(r.URL.Query().Get("in_stock"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		parts, err := repository.SearchParts(r.Context(), query, filter)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			internalError(w, r, err)
+			return
+		}
+
+		if err := presentParts(repository, r, parts); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -193,3 +335,16 @@ func SearchPartsHandler(repository *Repository) http.HandlerFunc {
 		json.NewEncoder(w).Encode(parts)
 	}
 }
+
+// presentParts converts prices into the currency requested by the caller,
+// adds dimensional weights, and shows or strips costs depending on the
+// caller's permissions.
+func presentParts(repository *Repository, r *http.Request, parts []Part) error {
+	if err := repository.ConvertPrices(r.Context(), parts, r.URL.Query().Get("currency")); err != nil {
+		return err
+	}
+	for i := range parts {
+		parts[i].Shipment.computeDimensionalWeight()
+	}
+	return repository.ApplyCostVisibility(r.Context(), parts, hasPermission(r, PermViewCost))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HazmatInfo classifies a dangerous good for transport.
+type HazmatInfo struct {
+	UNNumber        string `json:"un_number"`
+	HazardClass     string `json:"hazard_class"`
+	PackingGroup    string `json:"packing_group,omitempty"`
+	LimitedQuantity bool   `json:"limited_quantity"`
+	SDSURL          string `json:"sds_url,omitempty"`
+}
+
+var unNumberPattern = regexp.MustCompile(`^(?:UN|NA)\d{4}$`)
+
+// hazardClasses lists the hazard classes and divisions, and whether
+// substances in them are assigned a packing group.
+var hazardClasses = map[string]bool{
+	"1.1": false, "1.2": false, "1.3": false, "1.4": false, "1.5": false, "1.6": false,
+	"2.1": false, "2.2": false, "2.3": false,
+	"3":   true,
+	"4.1": true, "4.2": true, "4.3": true,
+	"5.1": true, "5.2": false,
+	"6.1": true, "6.2": false,
+	"7": false,
+	"8": true,
+	"9": true,
+}
+
+func (h *HazmatInfo) normalize() error {
+	h.UNNumber = strings.ToUpper(strings.ReplaceAll(h.UNNumber, " ", ""))
+	if len(h.UNNumber) == 4 {
+		h.UNNumber = "UN" + h.UNNumber
+	}
+	if !unNumberPattern.MatchString(h.UNNumber) {
+		return invalidf("invalid UN number %q", h.UNNumber)
+	}
+
+	hasPackingGroup, ok := hazardClasses[h.HazardClass]
+	if !ok {
+		return invalidf("invalid hazard class %q", h.HazardClass)
+	}
+	h.PackingGroup = strings.ToUpper(h.PackingGroup)
+	switch {
+	case h.PackingGroup == "" && hasPackingGroup:
+		return invalidf("hazard class %s requires a packing group", h.HazardClass)
+	case h.PackingGroup != "" && !hasPackingGroup:
+		return invalidf("hazard class %s has no packing group", h.HazardClass)
+	case h.PackingGroup != "" && h.PackingGroup != "I" && h.PackingGroup != "II" && h.PackingGroup != "III":
+		return invalidf("invalid packing group %q", h.PackingGroup)
+	}
+
+	if h.SDSURL != "" {
+		u, err := url.Parse(h.SDSURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalidf("invalid SDS link %q", h.SDSURL)
+		}
+	}
+	return nil
+}
+
+// segregationGroup maps a hazmat entry to a row of the segregation table.
+// Explosives share one row, and only packing group I toxics are segregated.
+func (h HazmatInfo) segregationGroup() string {
+	switch {
+	case strings.HasPrefix(h.HazardClass, "1."):
+		return "1"
+	case h.HazardClass == "6.1" && h.PackingGroup == "I":
+		return "6.1-I"
+	default:
+		return h.HazardClass
+	}
+}
+
+// Segregation requirements between two groups.
+const (
+	segregateApart    = "X" // must not be packed or loaded together
+	segregateSeparate = "O" // must be separated within the shipment
+)
+
+// segregationTable is a simplified form of the highway segregation table in
+// 49 CFR 177.848. It is a screening aid and does not replace a shipper's
+// own hazmat review.
+var segregationTable = map[[2]string]string{}
+
+func init() {
+	rules := []struct {
+		group       string
+		others      []string
+		requirement string
+	}{
+		{"1", []string{"1", "2.1", "2.2", "2.3", "3", "4.1", "4.2", "4.3", "5.1", "5.2", "6.1-I", "7", "8"}, segregateApart},
+		{"2.3", []string{"3", "4.2", "4.3", "5.1", "5.2", "8"}, segregateApart},
+		{"6.1-I", []string{"3", "4.2", "4.3", "5.1", "5.2", "8"}, segregateApart},
+		{"2.1", []string{"5.1", "5.2"}, segregateSeparate},
+		{"3", []string{"5.1", "5.2"}, segregateSeparate},
+		{"4.1", []string{"5.1"}, segregateSeparate},
+		{"4.2", []string{"5.1", "8"}, segregateSeparate},
+		{"4.3", []string{"8"}, segregateSeparate},
+		{"5.1", []string{"8"}, segregateSeparate},
+	}
+	for _, rule := range rules {
+		for _, other := range rule.others {
+			segregationTable[[2]string{rule.group, other}] = rule.requirement
+			segregationTable[[2]string{other, rule.group}] = rule.requirement
+		}
+	}
+}
+
+type CompatibilityFinding struct {
+	Severity string   `json:"severity"`
+	Rule     string   `json:"rule"`
+	PartIDs  []string `json:"part_ids"`
+	Message  string   `json:"message"`
+}
+
+type CompatibilityReport struct {
+	Compatible bool                   `json:"compatible"`
+	Findings   []CompatibilityFinding `json:"findings"`
+}
+
+// segregation returns the segregation requirement between two parts, or ""
+// when they may be packed together. Limited quantities are excepted, and so
+// are units of the same part, which class 1 would otherwise flag against itself.
+func segregation(a, b Part) string {
+	ha, hb := a.Shipment.Hazmat, b.Shipment.Hazmat
+	if ha == nil || hb == nil || ha.LimitedQuantity || hb.LimitedQuantity {
+		return ""
+	}
+	if a.ID != "" && a.ID == b.ID {
+		return ""
+	}
+	return segregationTable[[2]string{ha.segregationGroup(), hb.segregationGroup()}]
+}
+
+// CheckCompatibility flags hazmat data that is missing and combinations of
+// parts that may not be packed into one shipment. The shipment is compatible
+// when there are no error findings.
+func CheckCompatibility(parts []Part) CompatibilityReport {
+	report := CompatibilityReport{Compatible: true, Findings: []CompatibilityFinding{}}
+	add := func(severity, rule, message string, ids ...string) {
+		if severity == "error" {
+			report.Compatible = false
+		}
+		report.Findings = append(report.Findings, CompatibilityFinding{Severity: severity, Rule: rule, PartIDs: ids, Message: message})
+	}
+
+	for _, part := range parts {
+		switch h := part.Shipment.Hazmat; {
+		case h == nil && part.Shipment.Hazardous:
+			add("error", "missing_classification", fmt.Sprintf("%s is hazardous but has no UN number or hazard class", part.Name), part.ID)
+		case h != nil && h.SDSURL == "":
+			add("warning", "missing_sds", fmt.Sprintf("%s (%s) has no safety data sheet link", part.Name, h.UNNumber), part.ID)
+		}
+	}
+
+	for i := range parts {
+		for j := i + 1; j < len(parts); j++ {
+			a, b := parts[i], parts[j]
+			switch segregation(a, b) {
+			case segregateApart:
+				add("error", "segregation", fmt.Sprintf("class %s (%s) and class %s (%s) must not be shipped together",
+					a.Shipment.Hazmat.HazardClass, a.Shipment.Hazmat.UNNumber, b.Shipment.Hazmat.HazardClass, b.Shipment.Hazmat.UNNumber), a.ID, b.ID)
+			case segregateSeparate:
+				add("warning", "separation", fmt.Sprintf("class %s (%s) and class %s (%s) must be separated within the shipment",
+					a.Shipment.Hazmat.HazardClass, a.Shipment.Hazmat.UNNumber, b.Shipment.Hazmat.HazardClass, b.Shipment.Hazmat.UNNumber), a.ID, b.ID)
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Severity == "error" && report.Findings[j].Severity != "error"
+	})
+	return report
+}
+
+// CheckShipmentCompatibility Checks whether parts can ship together
+// @Summary      Check hazmat compatibility
+// @Description  Flag missing hazmat data and incompatible combinations of parts
+// @Tags         /shipping/compatibility
+// @Accept       part ids
+// @Produce      compatibility report
+func (r *Repository) CheckShipmentCompatibility(ctx context.Context, ids []string) (CompatibilityReport, error) {
+	if len(ids) == 0 {
+		return CompatibilityReport{}, invalidf("part_ids are required")
+	}
+	parts := make([]Part, 0, len(ids))
+	seen := map[string]bool{}
+	for _, id := range ids {
+		// A part listed twice is checked once, not against itself
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		part, err := r.GetPart(ctx, id)
+		if errors.Is(err, errNotFound) {
+			return CompatibilityReport{}, invalidf("part %s not found", id)
+		} else if err != nil {
+			return CompatibilityReport{}, err
+		}
+		parts = append(parts, part)
+	}
+	return CheckCompatibility(parts), nil
+}
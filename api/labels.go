@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed labels/*.tmpl
+var defaultLabelTemplates embed.FS
+
+// Label types and output formats. Each pair has a template named
+// "<type>.<format>.tmpl".
+var (
+	labelTypes   = []string{"part", "bin"}
+	labelFormats = []string{"zpl", "pdf"}
+)
+
+// LabelData is the data passed to label templates.
+type LabelData struct {
+	Part      Part
+	Location  string
+	Barcode   string
+	Hazmat    *HazmatInfo
+	Hazardous bool
+	Fragile   bool
+}
+
+// LabelTemplates holds the parsed label templates. PDF templates render a
+// page content stream; the page size is set with the page function.
+type LabelTemplates struct {
+	templates map[string]*template.Template
+}
+
+// LoadLabelTemplates parses the built-in label templates, replacing any of
+// them with a file of the same name in dir.
+func LoadLabelTemplates(dir string) (*LabelTemplates, error) {
+	labels := &LabelTemplates{templates: map[string]*template.Template{}}
+	for _, labelType := range labelTypes {
+		for _, format := range labelFormats {
+			name := labelType + "." + format + ".tmpl"
+			source, err := defaultLabelTemplates.ReadFile("labels/" + name)
+			if err != nil {
+				return nil, err
+			}
+			if dir != "" {
+				custom, err := os.ReadFile(filepath.Join(dir, name))
+				switch {
+				case err == nil:
+					source = custom
+				case !os.IsNotExist(err):
+					return nil, err
+				}
+			}
+
+			funcs := zplFuncs
+			if format == "pdf" {
+				funcs = (&pdfPage{}).funcs()
+			}
+			tmpl, err := template.New(name).Funcs(funcs).Parse(string(source))
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %v", name, err)
+			}
+			labels.templates[labelType+"."+format] = tmpl
+		}
+	}
+	return labels, nil
+}
+
+var zplFuncs = template.FuncMap{
+	"zpl": zplEscape,
+}
+
+// zplEscape escapes field data for use after ^FH, which reads _ followed by
+// two hex digits as a character.
+func zplEscape(s string) string {
+	return strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E").Replace(s)
+}
+
+// Render renders a label of the given type and format.
+func (l *LabelTemplates) Render(labelType, format string, data LabelData) ([]byte, error) {
+	tmpl, ok := l.templates[labelType+"."+format]
+	if !ok {
+		return nil, invalidf("unknown label type %q or format %q", labelType, format)
+	}
+	if _, err := code128Modules(data.Barcode); err != nil {
+		return nil, err
+	}
+
+	if format != "pdf" {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	page := &pdfPage{width: 288, height: 144}
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	var content bytes.Buffer
+	if err := tmpl.Funcs(page.funcs()).Execute(&content, data); err != nil {
+		return nil, err
+	}
+	return page.document(content.Bytes()), nil
+}
+
+// NewLabelData builds the data for a part or bin label. Location defaults to
+// the part's location; bin labels carry the location in the barcode.
+func NewLabelData(part Part, labelType, location string) (LabelData, error) {
+	if location == "" {
+		location = part.Location
+	}
+
+	data := LabelData{
+		Part:      part,
+		Location:  location,
+		Barcode:   part.SKU,
+		Hazmat:    part.Shipment.Hazmat,
+		Hazardous: part.Shipment.Hazardous,
+		Fragile:   part.Shipment.Fragile,
+	}
+	if data.Barcode == "" {
+		data.Barcode = part.ID
+	}
+	if labelType == "bin" {
+		if location == "" {
+			return LabelData{}, invalidf("location is required for a bin label")
+		}
+		data.Barcode = location
+	}
+	return data, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Part label Handler
+func PartLabelHandler(repository *Repository, labels *LabelTemplates) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		part, err := repository.GetPart(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		labelType := r.URL.Query().Get("type")
+		if labelType == "" {
+			labelType = "part"
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "zpl"
+		}
+
+		data, err := NewLabelData(part, labelType, r.URL.Query().Get("location"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		label, err := labels.Render(labelType, format, data)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		switch format {
+		case "pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+		default:
+			w.Header().Set("Content-Type", "application/zpl")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", labelType+"-"+id+"."+format))
+		w.Write(label)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Movement types accepted by RecordMovement. A transfer is written to the
+// ledger as a transfer_out entry and a transfer_in entry sharing a movement ID.
+const (
+	MovementReceive     = "receive"
+	MovementTransfer    = "transfer"
+	MovementTransferOut = "transfer_out"
+	MovementTransferIn  = "transfer_in"
+	MovementAdjust      = "adjust"
+	MovementIssue       = "issue"
+)
+
+// reasonCodes lists the reason codes accepted on adjustments.
+var reasonCodes = map[string]bool{
+	"count":      true,
+	"damaged":    true,
+	"lost":       true,
+	"found":      true,
+	"expired":    true,
+	"correction": true,
+}
+
+type Movement struct {
+	Type         string `json:"type"`
+	Quantity     int    `json:"quantity"`
+	Location     string `json:"location"`
+	FromLocation string `json:"from_location"`
+	ToLocation   string `json:"to_location"`
+	ReasonCode   string `json:"reason_code"`
+	WorkOrder    string `json:"work_order"`
+	Reference    string `json:"reference"`
+}
+
+type LedgerEntry struct {
+	ID          int64  `json:"id"`
+	MovementID  string `json:"movement_id"`
+	PartID      string `json:"part_id"`
+	Location    string `json:"location"`
+	Type        string `json:"type"`
+	Quantity    int    `json:"quantity"`
+	OnHandAfter int    `json:"on_hand_after"`
+	ReasonCode  string `json:"reason_code,omitempty"`
+	WorkOrder   string `json:"work_order,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// LedgerFilter narrows ledger queries. Zero values are ignored.
+type LedgerFilter struct {
+	PartID   string
+	Location string
+	Limit    int
+}
+
+// validate checks that the movement carries the fields its type needs.
+func (m Movement) validate() error {
+	if m.Quantity <= 0 && m.Type != MovementAdjust {
+		return invalidf("quantity must be positive")
+	}
+	switch m.Type {
+	case MovementReceive:
+		if m.Location == "" {
+			return invalidf("location is required")
+		}
+	case MovementTransfer:
+		if m.FromLocation == "" || m.ToLocation == "" {
+			return invalidf("from_location and to_location are required")
+		}
+		if m.FromLocation == m.ToLocation {
+			return invalidf("from_location and to_location must differ")
+		}
+	case MovementAdjust:
+		if m.Location == "" {
+			return invalidf("location is required")
+		}
+		if m.Quantity == 0 {
+			return invalidf("quantity must not be zero")
+		}
+		if !reasonCodes[m.ReasonCode] {
+			return invalidf("invalid reason_code %q", m.ReasonCode)
+		}
+	case MovementIssue:
+		if m.Location == "" {
+			return invalidf("location is required")
+		}
+		if m.WorkOrder == "" {
+			return invalidf("work_order is required")
+		}
+	default:
+		return invalidf("invalid movement type %q", m.Type)
+	}
+	return nil
+}
+
+// RecordMovement Records an inventory movement in the ledger
+// @Summary      Record movement
+// @Description  Append ledger entries and update stock levels in one transaction
+// @Tags         /parts/{id}/movements
+// @Accept       id, movement
+// @Produce      ledger entries
+func (r *Repository) RecordMovement(ctx context.Context, id string, movement Movement) ([]LedgerEntry, error) {
+	if err := movement.validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM parts WHERE id = ?`, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("part %w", errNotFound)
+	}
+
+	movementID, err := newMovementID()
+	if err != nil {
+		return nil, err
+	}
+	base := LedgerEntry{
+		MovementID: movementID,
+		PartID:     id,
+		ReasonCode: movement.ReasonCode,
+		WorkOrder:  movement.WorkOrder,
+		Reference:  movement.Reference,
+	}
+
+	var entries []LedgerEntry
+	post := func(location, entryType string, quantity int) error {
+		entry := base
+		entry.Location = location
+		entry.Type = entryType
+		entry.Quantity = quantity
+		entry, err := postLedgerEntry(ctx, tx, entry)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	}
+
+	switch movement.Type {
+	case MovementReceive:
+		err = post(movement.Location, MovementReceive, movement.Quantity)
+	case MovementTransfer:
+		err = post(movement.FromLocation, MovementTransferOut, -movement.Quantity)
+		if err == nil {
+			err = post(movement.ToLocation, MovementTransferIn, movement.Quantity)
+		}
+	case MovementAdjust:
+		err = post(movement.Location, MovementAdjust, movement.Quantity)
+	case MovementIssue:
+		err = post(movement.Location, MovementIssue, -movement.Quantity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// postLedgerEntry applies entry.Quantity to the stock level at entry.Location
+// and appends the entry to the ledger. Outbound entries may not take more than
+// the available (unreserved) quantity; adjustments may consume reserved stock
+// but never drive on-hand below zero.
+func postLedgerEntry(ctx context.Context, tx *sql.Tx, entry LedgerEntry) (LedgerEntry, error) {
+	_, err := tx.ExecContext(ctx, `INSERT IGNORE INTO part_stock (part_id, location, on_hand, reserved) VALUES (?, ?, 0, 0)`, entry.PartID, entry.Location)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+
+	var onHand, reserved int
+	query := `SELECT on_hand, reserved FROM part_stock WHERE part_id = ? AND location = ? FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, query, entry.PartID, entry.Location).Scan(&onHand, &reserved); err != nil {
+		return LedgerEntry{}, err
+	}
+
+	onHand += entry.Quantity
+	if onHand < 0 {
+		return LedgerEntry{}, invalidf("insufficient stock at %s", entry.Location)
+	}
+	if entry.Type != MovementAdjust && entry.Quantity < 0 && onHand < reserved {
+		return LedgerEntry{}, invalidf("insufficient available stock at %s", entry.Location)
+	}
+	if reserved > onHand {
+		reserved = onHand
+	}
+
+	updateQuery := `UPDATE part_stock SET on_hand = ?, reserved = ? WHERE part_id = ? AND location = ?`
+	if _, err := tx.ExecContext(ctx, updateQuery, onHand, reserved, entry.PartID, entry.Location); err != nil {
+		return LedgerEntry{}, err
+	}
+
+	entry.OnHandAfter = onHand
+	entry.Timestamp = time.Now().UTC().Format("2006-01-02 15:04:05")
+	insertQuery := `
+		INSERT INTO inventory_ledger (movement_id, part_id, location, type, quantity, on_hand_after, reason_code, work_order, reference, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := tx.ExecContext(ctx, insertQuery, entry.MovementID, entry.PartID, entry.Location, entry.Type, entry.Quantity, entry.OnHandAfter, entry.ReasonCode, entry.WorkOrder, entry.Reference, entry.Timestamp)
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	entry.ID, err = result.LastInsertId()
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// ListLedger List ledger entries from db
+// @Summary      List ledger entries
+// @Description  List ledger entries for a part or a location, newest first
+// @Tags         /parts/{id}/ledger, /locations/{location}/ledger
+// @Accept       ledger filter
+// @Produce      ledger entries
+func (r *Repository) ListLedger(ctx context.Context, filter LedgerFilter) ([]LedgerEntry, error) {
+	query := `SELECT id, movement_id, part_id, location, type, quantity, on_hand_after, reason_code, work_order, reference, timestamp FROM inventory_ledger WHERE 1 = 1`
+	var args []interface{}
+	if filter.PartID != "" {
+		query += " AND part_id = ?"
+		args = append(args, filter.PartID)
+	}
+	if filter.Location != "" {
+		query += " AND location = ?"
+		args = append(args, filter.Location)
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var entry LedgerEntry
+		if err := rows.Scan(&entry.ID, &entry.MovementID, &entry.PartID, &entry.Location, &entry.Type, &entry.Quantity, &entry.OnHandAfter, &entry.ReasonCode, &entry.WorkOrder, &entry.Reference, &entry.Timestamp); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func newMovementID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Record inventory movement Handler
+func RecordMovementHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		var movement Movement
+		if err := json.NewDecoder(r.Body).Decode(&movement); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entries, err := repository.RecordMovement(r.Context(), id, movement)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// List Part ledger Handler
+func ListPartLedgerHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseLedgerFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.PartID = mux.Vars(r)["id"]
+
+		entries, err := repository.ListLedger(r.Context(), filter)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// List Location ledger Handler
+func ListLocationLedgerHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseLedgerFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Location = mux.Vars(r)["location"]
+
+		entries, err := repository.ListLedger(r.Context(), filter)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// parseLedgerFilter reads the optional part_id, location and limit query parameters.
+func parseLedgerFilter(r *http.Request) (LedgerFilter, error) {
+	q := r.URL.Query()
+	filter := LedgerFilter{PartID: q.Get("part_id"), Location: q.Get("location")}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return LedgerFilter{}, fmt.Errorf("invalid limit %q", limit)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+)
+
+// accessLogMode is which requests are written to the access log: "all",
+// "errors" for responses with a status of 400 or more, or "off".
+var accessLogMode = "all"
+
+// NewLoggerFromEnv returns the server's logger. It writes JSON lines unless
+// LOG_FORMAT is "text", at LOG_LEVEL (debug, info, warn or error; info by
+// default).
+func NewLoggerFromEnv() (*slog.Logger, error) {
+	var level slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q", value)
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format := os.Getenv("LOG_FORMAT"); format {
+	case "", "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q; use json or text", format)
+	}
+	return slog.New(requestIDHandler{handler}), nil
+}
+
+// requestIDHandler adds the request ID to records logged with the context of
+// a request, or of work done on its behalf.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// fatal logs an error and exits, for configuration the server cannot start
+// without.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// internalError logs an error the client cannot act on and responds with a
+// generic message and the request ID, so the client can report it without
+// seeing database or driver details.
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "route", routeTemplate(r), "error", err)
+	message := "internal server error"
+	if id := requestIDFromContext(r.Context()); id != "" {
+		message += "; request ID " + id
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// routeTemplate returns the route a request matched, such as /parts/{id}.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+// parseAccessLogMode checks an ACCESS_LOG value.
+func parseAccessLogMode(value string) (string, error) {
+	switch mode := strings.ToLower(value); mode {
+	case "all", "errors", "off":
+		return mode, nil
+	case "true", "on":
+		return "all", nil
+	case "false":
+		return "off", nil
+	default:
+		return "", fmt.Errorf("invalid ACCESS_LOG %q; use all, errors or off", value)
+	}
+}
+
+// AccessLogMiddleware logs one line per request with its route, status,
+// size and duration, according to accessLogMode. Scrapes of /metrics are
+// logged at debug level so they do not drown out traffic.
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accessLogMode == "off" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+		if accessLogMode == "errors" && metrics.Code < 400 {
+			return
+		}
+		route := routeTemplate(r)
+		level := slog.LevelInfo
+		switch {
+		case metrics.Code >= 500:
+			level = slog.LevelError
+		case metrics.Code >= 400:
+			level = slog.LevelWarn
+		case route == "/metrics":
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "Request",
+			"method", r.Method,
+			"route", route,
+			"path", r.URL.Path,
+			"status", metrics.Code,
+			"bytes", metrics.Written,
+			"duration_ms", float64(metrics.Duration.Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
@@ -1,16 +1,39 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/gorilla/handlers"
 )
 
 func main() {
+	migrateDimensions := flag.Bool("migrate-dimensions", false, "parse free-text shipment sizes into structured dimensions and exit")
+	createAPIKey := flag.String("create-api-key", "", "issue an API key with this name, print it and exit")
+	apiKeyRole := flag.String("role", RoleAdmin, "role of the key issued with -create-api-key")
+	flag.Parse()
+
+	// Log JSON lines, with the request ID of the request being served
+	logger, err := NewLoggerFromEnv()
+	if err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	slog.SetDefault(logger)
+	if value := os.Getenv("ACCESS_LOG"); value != "" {
+		if accessLogMode, err = parseAccessLogMode(value); err != nil {
+			fatal("Invalid ACCESS_LOG", err)
+		}
+	}
+
 	// Set up the database connection
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
@@ -20,22 +43,162 @@ func main() {
 
 	dsn := dbUser + ":" + dbPassword + "@tcp(" + dbHost + ":" + dbPort + ")/" + dbName
 
-	db, err := sql.Open("mysql", dsn)
+	connector, err := mysql.MySQLDriver{}.OpenConnector(dsn)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
+	// Time every statement for the metrics endpoint
+	db := sql.OpenDB(metricsConnector{connector})
 	defer db.Close()
 
 	// Initialize the repository with the database connection
 	repository := NewRepository(db)
-	router := NewRouter(repository)
+	ctx := context.Background()
+
+	if *migrateDimensions {
+		migration, err := repository.MigrateShipmentDimensions(ctx)
+		if err != nil {
+			fatal("Failed to migrate shipment dimensions", err)
+		}
+		if err := repository.appendSystemAudit(ctx, "cli", "migrate dimensions", "parts", "", migration); err != nil {
+			fatal("Failed to record the migration in the audit log", err)
+		}
+		json.NewEncoder(os.Stdout).Encode(migration)
+		return
+	}
+
+	if *createAPIKey != "" {
+		key, err := repository.IssueAPIKey(ctx, *createAPIKey, *apiKeyRole, nil)
+		if err != nil {
+			fatal("Failed to create API key", err)
+		}
+		if err := repository.appendSystemAudit(ctx, "cli", "create api key", "keys", key.ID, map[string]string{"name": key.Name, "role": key.Role}); err != nil {
+			fatal("Failed to record the API key in the audit log", err)
+		}
+		json.NewEncoder(os.Stdout).Encode(key)
+		return
+	}
+
+	if value := os.Getenv("DIM_DIVISORS"); value != "" {
+		divisors, err := parseDimDivisors(value)
+		if err != nil {
+			fatal("Invalid DIM_DIVISORS", err)
+		}
+		dimDivisors = divisors
+	}
+
+	if value := os.Getenv("UI_BASE_URL"); value != "" {
+		uiBaseURL = strings.TrimSuffix(value, "/")
+	}
+
+	// Evaluate reorder points in the background and send low-stock alerts
+	notifier, err := NewNotifierFromEnv()
+	if err != nil {
+		fatal("Failed to configure notifier", err)
+	}
+	interval := 5 * time.Minute
+	if value := os.Getenv("REORDER_INTERVAL"); value != "" {
+		interval, err = parsePositiveDuration(value)
+		if err != nil {
+			fatal("Invalid REORDER_INTERVAL", err)
+		}
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go StartReorderEvaluator(repository, notifier, interval, stop)
+
+	// Send queued webhook deliveries in the background
+	webhookInterval := 5 * time.Second
+	if value := os.Getenv("WEBHOOK_INTERVAL"); value != "" {
+		webhookInterval, err = parsePositiveDuration(value)
+		if err != nil {
+			fatal("Invalid WEBHOOK_INTERVAL", err)
+		}
+	}
+	go StartWebhookDispatcher(repository, webhookInterval, stop)
+
+	// Publish part events from the outbox to webhooks and the in-process broker
+	if value := os.Getenv("OUTBOX_RETENTION"); value != "" {
+		outboxRetention, err = parsePositiveDuration(value)
+		if err != nil {
+			fatal("Invalid OUTBOX_RETENTION", err)
+		}
+	}
+	outboxInterval := time.Second
+	if value := os.Getenv("OUTBOX_INTERVAL"); value != "" {
+		outboxInterval, err = parsePositiveDuration(value)
+		if err != nil {
+			fatal("Invalid OUTBOX_INTERVAL", err)
+		}
+	}
+	broker := NewBroker()
+	outbox := NewOutboxDispatcher(repository)
+	if err := outbox.Register(ctx, WebhookPublisher{repository: repository}, true); err != nil {
+		fatal("Failed to register the webhook publisher", err)
+	}
+	if err := outbox.Register(ctx, broker, false); err != nil {
+		fatal("Failed to register the broker", err)
+	}
+	go outbox.Start(outboxInterval, stop)
 
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
-	originsOk := handlers.AllowedOrigins([]string{"*"})
+	// Load carrier rate tables for shipping quotes
+	var rates []CarrierRateTable
+	if path := os.Getenv("SHIPPING_RATES_PATH"); path != "" {
+		rates, err = LoadCarrierRates(path)
+		if err != nil {
+			fatal("Failed to load carrier rates", err)
+		}
+	}
+
+	// Load the box catalog for cartonization
+	var boxes []Box
+	if path := os.Getenv("BOX_CATALOG_PATH"); path != "" {
+		boxes, err = LoadBoxCatalog(path)
+		if err != nil {
+			fatal("Failed to load box catalog", err)
+		}
+	}
+
+	// Load label templates, with overrides from LABEL_TEMPLATE_DIR
+	labels, err := LoadLabelTemplates(os.Getenv("LABEL_TEMPLATE_DIR"))
+	if err != nil {
+		fatal("Failed to load label templates", err)
+	}
+
+	auth, err := NewAuthenticatorFromEnv(repository)
+	if err != nil {
+		fatal("Failed to configure authentication", err)
+	}
+
+	router := NewRouter(repository, notifier, rates, boxes, labels, auth, outbox, broker, NewMetricsRegistry(db, repository))
+
+	// Only the UI origin may call the API from a browser unless CORS_ALLOWED_ORIGINS says otherwise
+	if value := os.Getenv("CORS_ALLOWED_ORIGINS"); value != "" {
+		allowedOrigins = strings.Split(value, ",")
+		for i := range allowedOrigins {
+			allowedOrigins[i] = strings.TrimSpace(allowedOrigins[i])
+		}
+	}
+
+	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "X-API-Key", "X-CSRF-Token", "X-Request-ID"})
+	originsOk := handlers.AllowedOrigins(allowedOrigins)
 	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS", "DELETE", "PATCH"})
 
-	log.Println("Starting server on :1710")
-	if err := http.ListenAndServe(":1710", handlers.CORS(originsOk, headersOk, methodsOk)(router)); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	slog.Info("Starting server", "addr", ":1710")
+	if err := http.ListenAndServe(":1710", handlers.CORS(originsOk, headersOk, methodsOk, handlers.AllowCredentials())(router)); err != nil {
+		fatal("Failed to start server", err)
+	}
+}
+
+// parsePositiveDuration parses a duration that must be greater than zero,
+// such as the interval of a ticker.
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s is not greater than zero", value)
 	}
+	return d, nil
 }
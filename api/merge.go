@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// MergeConflict is a field, or a key of attributes, metadata or shipment,
+// that the current version and an incoming edit both changed from the base
+// version, to different values. A nil value means the field or key is not
+// set.
+type MergeConflict struct {
+	Field    string      `json:"field"`
+	Key      string      `json:"key,omitempty"`
+	Base     interface{} `json:"base"`
+	Current  interface{} `json:"current"`
+	Incoming interface{} `json:"incoming"`
+}
+
+// mergeIgnored are fields set by the server rather than edited.
+var mergeIgnored = map[string]bool{
+	"id": true, "version": true, "timestamp": true, "margin": true,
+	"author": true, "change_comment": true, "request_id": true, "base_version": true,
+}
+
+// mergeByKey are objects whose keys are merged one by one. Other objects,
+// such as prices and dimensions, only make sense as a whole.
+var mergeByKey = map[string]bool{"attributes": true, "metadata": true, "shipment": true}
+
+// mergeDerived are keys computed from other ones, which are never stored.
+var mergeDerived = map[string]bool{"dimensional_weight": true}
+
+// mergeParts merges an edit made against base with the changes saved since
+// in current. A field or key changed on one side only takes that side's
+// value. Conflicting ones keep the current value in the merged part and are
+// returned. The merged part carries the author, comment and request ID of
+// the edit.
+func mergeParts(base, current, incoming Part) (Part, []MergeConflict, error) {
+	// Compare the edit in the form the versions were stored in
+	incoming.normalizeCurrencies()
+	if err := incoming.Shipment.normalize(); err != nil {
+		return Part{}, nil, err
+	}
+	if err := incoming.normalizeGTIN(); err != nil {
+		return Part{}, nil, err
+	}
+
+	var b, c, i map[string]interface{}
+	for _, pair := range []struct {
+		part Part
+		out  *map[string]interface{}
+	}{{base, &b}, {current, &c}, {incoming, &i}} {
+		if err := toJSONObject(pair.part, pair.out); err != nil {
+			return Part{}, nil, err
+		}
+	}
+
+	var conflicts []MergeConflict
+	merged := map[string]interface{}{}
+	for _, field := range unionKeys(b, c, i) {
+		if mergeIgnored[field] {
+			if value, ok := c[field]; ok {
+				merged[field] = value
+			}
+			continue
+		}
+		if mergeByKey[field] && isObject(b[field]) && isObject(c[field]) && isObject(i[field]) {
+			bo, co, io := asObject(b[field]), asObject(c[field]), asObject(i[field])
+			object := map[string]interface{}{}
+			for _, key := range unionKeys(bo, co, io) {
+				if mergeDerived[key] {
+					continue
+				}
+				value, conflict := mergeValue(bo[key], co[key], io[key])
+				if conflict {
+					conflicts = append(conflicts, MergeConflict{Field: field, Key: key, Base: bo[key], Current: co[key], Incoming: io[key]})
+				}
+				if value != nil {
+					object[key] = value
+				}
+			}
+			merged[field] = object
+			continue
+		}
+		value, conflict := mergeValue(b[field], c[field], i[field])
+		if conflict {
+			conflicts = append(conflicts, MergeConflict{Field: field, Base: b[field], Current: c[field], Incoming: i[field]})
+		}
+		if value != nil {
+			merged[field] = value
+		}
+	}
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return Part{}, nil, err
+	}
+	var part Part
+	if err := json.Unmarshal(raw, &part); err != nil {
+		return Part{}, nil, err
+	}
+	part.Author, part.ChangeComment, part.RequestID = incoming.Author, incoming.ChangeComment, incoming.RequestID
+	return part, conflicts, nil
+}
+
+// mergeValue returns the value of a three-way merge, and whether both sides
+// changed it differently, in which case it is the current value.
+func mergeValue(base, current, incoming interface{}) (interface{}, bool) {
+	base, current, incoming = emptyToNil(base), emptyToNil(current), emptyToNil(incoming)
+	switch {
+	case reflect.DeepEqual(incoming, base), reflect.DeepEqual(incoming, current):
+		return current, false
+	case reflect.DeepEqual(current, base):
+		return incoming, false
+	default:
+		return current, true
+	}
+}
+
+func toJSONObject(part Part, out *map[string]interface{}) error {
+	raw, err := json.Marshal(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// emptyToNil treats an empty list, object or string like a missing one.
+func emptyToNil(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	}
+	return value
+}
+
+func isObject(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok || value == nil
+}
+
+func asObject(value interface{}) map[string]interface{} {
+	object, _ := value.(map[string]interface{})
+	return object
+}
+
+// unionKeys returns the keys of the objects in sorted order.
+func unionKeys(objects ...map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, object := range objects {
+		for key := range object {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeValue(t *testing.T) {
+	tests := []struct {
+		name                    string
+		base, current, incoming interface{}
+		want                    interface{}
+		conflict                bool
+	}{
+		{name: "unchanged", base: "a", current: "a", incoming: "a", want: "a"},
+		{name: "changed by the edit", base: "a", current: "a", incoming: "b", want: "b"},
+		{name: "changed since the edit", base: "a", current: "b", incoming: "a", want: "b"},
+		{name: "same change on both sides", base: "a", current: "b", incoming: "b", want: "b"},
+		{name: "different changes", base: "a", current: "b", incoming: "c", want: "b", conflict: true},
+		{name: "cleared by the edit", base: "a", current: "a", incoming: "", want: nil},
+		{name: "set by the edit", base: nil, current: "", incoming: "x", want: "x"},
+		{name: "cleared against a change", base: "a", current: "b", incoming: nil, want: "b", conflict: true},
+		{name: "empty list is unset", base: []interface{}{}, current: nil, incoming: []interface{}{"x"}, want: []interface{}{"x"}},
+		{name: "empty object is unset", base: nil, current: map[string]interface{}{}, incoming: nil, want: nil},
+		{
+			name:     "objects compare as a whole",
+			base:     map[string]interface{}{"amount": "1.00", "currency": "USD"},
+			current:  map[string]interface{}{"amount": "2.00", "currency": "USD"},
+			incoming: map[string]interface{}{"amount": "1.00", "currency": "EUR"},
+			want:     map[string]interface{}{"amount": "2.00", "currency": "USD"},
+			conflict: true,
+		},
+		{name: "numbers", base: 1.5, current: 1.5, incoming: 2.0, want: 2.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := mergeValue(tt.base, tt.current, tt.incoming)
+			if !reflect.DeepEqual(got, tt.want) || conflict != tt.conflict {
+				t.Errorf("mergeValue = %v, %v, want %v, %v", got, conflict, tt.want, tt.conflict)
+			}
+		})
+	}
+}
+
+// mergeTestPart is a part as it is stored: currencies and the weight unit
+// filled in.
+func mergeTestPart() Part {
+	return Part{
+		ID:          "7",
+		Name:        "Bolt",
+		SKU:         "B-6",
+		Description: "M6 bolt",
+		Price:       Money{Cents: 150, Currency: "USD"},
+		Attributes:  map[string]string{"material": "steel", "thread": "M6"},
+		FitmentData: []string{"frame"},
+		Location:    "A1",
+		Shipment:    ShipmentInfo{Weight: 0.1, WeightUnit: "lb"},
+		Metadata:    map[string]string{"bin": "3"},
+		Version:     1,
+		Timestamp:   "2024-05-01T12:00:00Z",
+	}
+}
+
+func TestMergeParts(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   func(*Part)
+		incoming  func(*Part)
+		want      func(*Part)
+		conflicts []MergeConflict
+	}{
+		{
+			name:     "different fields",
+			current:  func(p *Part) { p.Name = "Hex bolt" },
+			incoming: func(p *Part) { p.Description = "M6 x 20 bolt" },
+			want:     func(p *Part) { p.Name, p.Description = "Hex bolt", "M6 x 20 bolt" },
+		},
+		{
+			name:      "same field",
+			current:   func(p *Part) { p.Name = "Hex bolt" },
+			incoming:  func(p *Part) { p.Name = "Carriage bolt" },
+			want:      func(p *Part) { p.Name = "Hex bolt" },
+			conflicts: []MergeConflict{{Field: "name", Base: "Bolt", Current: "Hex bolt", Incoming: "Carriage bolt"}},
+		},
+		{
+			name:     "different attribute keys",
+			current:  func(p *Part) { p.Attributes = map[string]string{"material": "steel", "thread": "M6", "finish": "zinc"} },
+			incoming: func(p *Part) { p.Attributes = map[string]string{"material": "stainless", "thread": "M6"} },
+			want: func(p *Part) {
+				p.Attributes = map[string]string{"material": "stainless", "thread": "M6", "finish": "zinc"}
+			},
+		},
+		{
+			name:      "same attribute key",
+			current:   func(p *Part) { p.Attributes = map[string]string{"material": "brass", "thread": "M6"} },
+			incoming:  func(p *Part) { p.Attributes = map[string]string{"material": "stainless", "thread": "M6"} },
+			want:      func(p *Part) { p.Attributes = map[string]string{"material": "brass", "thread": "M6"} },
+			conflicts: []MergeConflict{{Field: "attributes", Key: "material", Base: "steel", Current: "brass", Incoming: "stainless"}},
+		},
+		{
+			name:     "attribute removed by the edit",
+			current:  func(p *Part) { p.Metadata = map[string]string{"bin": "4"} },
+			incoming: func(p *Part) { p.Attributes = map[string]string{"material": "steel"} },
+			want: func(p *Part) {
+				p.Attributes = map[string]string{"material": "steel"}
+				p.Metadata = map[string]string{"bin": "4"}
+			},
+		},
+		{
+			name:     "shipment keys",
+			current:  func(p *Part) { p.Shipment.Fragile = true },
+			incoming: func(p *Part) { p.Shipment.Weight = 0.2 },
+			want:     func(p *Part) { p.Shipment.Fragile, p.Shipment.Weight = true, 0.2 },
+		},
+		{
+			name:     "price is merged as a whole",
+			current:  func(p *Part) { p.Price = Money{Cents: 175, Currency: "USD"} },
+			incoming: func(p *Part) { p.Price = Money{Cents: 150, Currency: "EUR"} },
+			want:     func(p *Part) { p.Price = Money{Cents: 175, Currency: "USD"} },
+			conflicts: []MergeConflict{{
+				Field:    "price",
+				Base:     map[string]interface{}{"amount": "1.50", "currency": "USD"},
+				Current:  map[string]interface{}{"amount": "1.75", "currency": "USD"},
+				Incoming: map[string]interface{}{"amount": "1.50", "currency": "EUR"},
+			}},
+		},
+		{
+			name:     "edit is normalized before comparing",
+			current:  func(p *Part) { p.Location = "B2" },
+			incoming: func(p *Part) { p.Price.Currency, p.Shipment.WeightUnit = "", "" },
+			want:     func(p *Part) { p.Location = "B2" },
+		},
+		{
+			name:     "server fields come from the current version",
+			current:  func(p *Part) { p.Version, p.Timestamp = 3, "2024-05-02T08:00:00Z" },
+			incoming: func(p *Part) { p.Version, p.Timestamp, p.Author, p.ChangeComment = 1, "", "key:abc", "fix name" },
+			want: func(p *Part) {
+				p.Version, p.Timestamp = 3, "2024-05-02T08:00:00Z"
+				p.Author, p.ChangeComment = "key:abc", "fix name"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, current, incoming, want := mergeTestPart(), mergeTestPart(), mergeTestPart(), mergeTestPart()
+			tt.current(&current)
+			tt.incoming(&incoming)
+			tt.want(&want)
+
+			merged, conflicts, err := mergeParts(base, current, incoming)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(merged, want) {
+				t.Errorf("merged =\n%+v, want\n%+v", merged, want)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %+v, want %+v", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pdm_http_requests_total",
+		Help: "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdm_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status code, without the change stream.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pdm_db_query_duration_seconds",
+		Help:    "Database statement latency by statement type and main table.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+)
+
+// catalogCollector reads business gauges from the database when metrics are
+// scraped.
+type catalogCollector struct {
+	repository *Repository
+	gauges     []catalogGauge
+}
+
+type catalogGauge struct {
+	desc  *prometheus.Desc
+	query string
+}
+
+func newCatalogCollector(repository *Repository) *catalogCollector {
+	gauge := func(name, help, query string) catalogGauge {
+		return catalogGauge{desc: prometheus.NewDesc(name, help, nil, nil), query: query}
+	}
+	return &catalogCollector{repository: repository, gauges: []catalogGauge{
+		gauge("pdm_parts", "Parts in the catalog.", `SELECT COUNT(*) FROM parts`),
+		gauge("pdm_part_versions", "Part versions created, for parts that still exist.", `SELECT COUNT(*) FROM part_versions`),
+		gauge("pdm_stock_alerts_open", "Low-stock alerts that are open.", `SELECT COUNT(*) FROM stock_alerts WHERE status = 'open'`),
+		gauge("pdm_webhook_deliveries_dead", "Webhook deliveries that ran out of attempts.", `SELECT COUNT(*) FROM webhook_deliveries WHERE status = 'dead'`),
+		gauge("pdm_outbox_head", "Sequence number of the newest outbox event.", `SELECT COALESCE(MAX(id), 0) FROM outbox`),
+	}}
+}
+
+func (c *catalogCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, gauge := range c.gauges {
+		ch <- gauge.desc
+	}
+}
+
+func (c *catalogCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, gauge := range c.gauges {
+		var value float64
+		if err := c.repository.db.QueryRow(gauge.query).Scan(&value); err != nil {
+			ch <- prometheus.NewInvalidMetric(gauge.desc, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(gauge.desc, prometheus.GaugeValue, value)
+	}
+}
+
+// NewMetricsRegistry returns a registry of the API's metrics: requests,
+// database statements and connection pool, catalog gauges, and the Go
+// runtime and process.
+func NewMetricsRegistry(db *sql.DB, repository *Repository) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		httpRequests,
+		httpRequestDuration,
+		dbQueryDuration,
+		collectors.NewDBStatsCollector(db, "vehicle_parts_db"),
+		newCatalogCollector(repository),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
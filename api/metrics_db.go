@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// metricsConnector times every statement run on its connections, inside
+// transactions or not, in dbQueryDuration.
+type metricsConnector struct {
+	driver.Connector
+}
+
+func (c metricsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &metricsConn{Conn: conn}, nil
+}
+
+// metricsConn passes through the optional interfaces of the MySQL driver's
+// connections, since database/sql only uses those that the wrapper has.
+type metricsConn struct {
+	driver.Conn
+}
+
+func (c *metricsConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *metricsConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &metricsStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *metricsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// QueryContext and ExecContext are only used by the driver for statements
+// without arguments; it returns driver.ErrSkip for the others, which
+// database/sql then prepares.
+func (c *metricsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		observeQuery(query, start)
+	}
+	return rows, err
+}
+
+func (c *metricsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		observeQuery(query, start)
+	}
+	return result, err
+}
+
+func (c *metricsConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *metricsConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *metricsConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *metricsConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type metricsStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *metricsStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer observeQuery(s.query, time.Now())
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return execer.ExecContext(ctx, args)
+	}
+	return s.Stmt.Exec(namedToValues(args))
+}
+
+func (s *metricsStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer observeQuery(s.query, time.Now())
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return queryer.QueryContext(ctx, args)
+	}
+	return s.Stmt.Query(namedToValues(args))
+}
+
+func (s *metricsStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func namedToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+func observeQuery(query string, start time.Time) {
+	operation, table := queryLabels(query)
+	dbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+}
+
+// queryLabels returns the statement type and main table of a query: the
+// first table after FROM, INTO or UPDATE outside parentheses, so that
+// subqueries do not count.
+func queryLabels(query string) (string, string) {
+	var words []string
+	depth := 0
+	start := -1
+	for i, r := range query + " " {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		}
+		word := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '`'
+		if word && start < 0 && depth == 0 {
+			start = i
+		} else if !word && start >= 0 {
+			words = append(words, strings.Trim(query[start:i], "`"))
+			start = -1
+		}
+	}
+	if len(words) == 0 {
+		return "other", ""
+	}
+
+	operation := strings.ToLower(words[0])
+	switch operation {
+	case "select", "insert", "update", "delete", "replace":
+	default:
+		return "other", ""
+	}
+	for i, word := range words[:len(words)-1] {
+		switch strings.ToUpper(word) {
+		case "FROM", "INTO", "UPDATE":
+			return operation, strings.ToLower(words[i+1])
+		}
+	}
+	return operation, ""
+}
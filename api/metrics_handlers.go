@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// longLivedRoutes stay open as long as the client listens, so their
+// duration says nothing about latency.
+var longLivedRoutes = map[string]bool{
+	"/events":    true,
+	"/events/ws": true,
+}
+
+// MetricsMiddleware counts requests and measures their latency by route
+// template, so that /parts/1 and /parts/2 share a series. It wraps the
+// response writer with httpsnoop, which keeps the Flusher and Hijacker the
+// change stream needs.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		metrics := httpsnoop.CaptureMetrics(next, w, r)
+		status := strconv.Itoa(metrics.Code)
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		if !longLivedRoutes[route] {
+			httpRequestDuration.WithLabelValues(route, r.Method, status).Observe(metrics.Duration.Seconds())
+		}
+	})
+}
+
+// Prometheus metrics Handler
+func MetricsHandler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// BaseCurrency is the currency exchange rates are quoted against.
+const BaseCurrency = "USD"
+
+// Money is an exact decimal amount with an ISO 4217 currency code. Amounts
+// are held in hundredths to match the DECIMAL(10, 2) price columns.
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+// maxCents is the largest amount the DECIMAL(10, 2) columns hold.
+const maxCents = 99_999_999_99
+
+// ParseMoney parses a decimal amount such as "12.34" or "-0.5". More than
+// two fractional digits is an error rather than being silently rounded.
+func ParseMoney(amount, currency string) (Money, error) {
+	cents, err := parseCents(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	if currency == "" {
+		currency = BaseCurrency
+	}
+	if !validCurrency(currency) {
+		return Money{}, invalidf("invalid currency %q", currency)
+	}
+	return Money{Cents: cents, Currency: currency}, nil
+}
+
+func parseCents(amount string) (int64, error) {
+	s := strings.TrimSpace(amount)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, invalidf("invalid amount %q", amount)
+	}
+	if len(frac) > 2 {
+		return 0, invalidf("amount %q has more than 2 decimal places", amount)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return 0, invalidf("invalid amount %q", amount)
+		}
+	}
+
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, invalidf("invalid amount %q", amount)
+	}
+	if negative {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+func validCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Amount formats the amount with exactly two fractional digits.
+func (m Money) Amount() string {
+	cents := m.Cents
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (m Money) String() string {
+	return m.Amount() + " " + m.Currency
+}
+
+// Rat returns the amount as an exact rational number.
+func (m Money) Rat() *big.Rat {
+	return big.NewRat(m.Cents, 100)
+}
+
+// moneyFromRat rounds r half away from zero to whole cents.
+func moneyFromRat(r *big.Rat, currency string) Money {
+	scaled := new(big.Rat).Mul(r, big.NewRat(100, 1))
+	num, den := scaled.Num(), scaled.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return Money{Cents: quo.Int64(), Currency: currency}
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Amount(), Currency: m.Currency})
+}
+
+// UnmarshalJSON accepts {"amount": "12.34", "currency": "EUR"} as well as a
+// bare number or string, which is taken to be in the base currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = []byte(strings.TrimSpace(string(data)))
+	if string(data) == "null" {
+		*m = Money{Currency: BaseCurrency}
+		return nil
+	}
+
+	var amount, currency string
+	switch data[0] {
+	case '{':
+		var raw struct {
+			Amount   json.RawMessage `json:"amount"`
+			Currency string          `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		amount, currency = strings.Trim(string(raw.Amount), `"`), raw.Currency
+	case '"':
+		if err := json.Unmarshal(data, &amount); err != nil {
+			return err
+		}
+	default:
+		amount = string(data)
+	}
+
+	parsed, err := ParseMoney(amount, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a DECIMAL column into the amount. The currency is stored in its
+// own column and scanned separately into m.Currency.
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		m.Cents = 0
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		m.Cents = v * 100
+		return nil
+	case float64:
+		s = strconv.FormatFloat(v, 'f', 2, 64)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+
+	cents, err := parseCents(s)
+	if err != nil {
+		return err
+	}
+	m.Cents = cents
+	return nil
+}
+
+// Value stores the amount as a decimal string so the database never sees a float.
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount(), nil
+}
+
+// RateTable maps a currency code to the number of units of that currency
+// per one unit of BaseCurrency.
+type RateTable map[string]*big.Rat
+
+// Convert converts m into the target currency, rounding to whole cents.
+func (t RateTable) Convert(m Money, to string) (Money, error) {
+	if to == "" || to == m.Currency {
+		return m, nil
+	}
+	from, ok := t.rate(m.Currency)
+	if !ok {
+		return Money{}, invalidf("no exchange rate for %s", m.Currency)
+	}
+	target, ok := t.rate(to)
+	if !ok {
+		return Money{}, invalidf("no exchange rate for %s", to)
+	}
+
+	converted := new(big.Rat).Mul(m.Rat(), target)
+	converted.Quo(converted, from)
+	return moneyFromRat(converted, to), nil
+}
+
+func (t RateTable) rate(currency string) (*big.Rat, bool) {
+	if currency == BaseCurrency {
+		return big.NewRat(1, 1), true
+	}
+	// A zero rate stored before rates were checked cannot be divided by
+	rate, ok := t[currency]
+	return rate, ok && rate.Sign() > 0
+}
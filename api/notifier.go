@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Notifier delivers low-stock alerts to people who can act on them.
+type Notifier interface {
+	Notify(ctx context.Context, alerts []StockAlert) error
+}
+
+// LogNotifier writes alerts to the server log. It is used when no SMTP
+// server is configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, alerts []StockAlert) error {
+	for _, alert := range alerts {
+		slog.WarnContext(ctx, "Low stock",
+			"part_id", alert.PartID,
+			"sku", alert.SKU,
+			"location", alert.Location,
+			"available", alert.Available,
+			"reorder_point", alert.ReorderPoint,
+			"suggested_quantity", alert.SuggestedQuantity,
+		)
+	}
+	return nil
+}
+
+// SMTPNotifier emails alerts through an SMTP server. Username may be left
+// empty for servers without authentication, such as a local mail catcher.
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// NewNotifierFromEnv returns an SMTPNotifier when SMTP_HOST is set and a
+// LogNotifier otherwise.
+func NewNotifierFromEnv() (Notifier, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogNotifier{}, nil
+	}
+
+	notifier := &SMTPNotifier{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if notifier.Port == "" {
+		notifier.Port = "25"
+	}
+	for _, to := range strings.Split(os.Getenv("SMTP_TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			notifier.To = append(notifier.To, to)
+		}
+	}
+	if notifier.From == "" || len(notifier.To) == 0 {
+		return nil, fmt.Errorf("SMTP_FROM and SMTP_TO are required when SMTP_HOST is set")
+	}
+	return notifier, nil
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, alerts []StockAlert) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(n.Host, n.Port), auth, n.From, n.To, n.message(alerts))
+}
+
+func (n *SMTPNotifier) message(alerts []StockAlert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: Low stock: %d part(s) at or below reorder point\r\n", len(alerts))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	for _, alert := range alerts {
+		fmt.Fprintf(&b, "%s (SKU %s, part %s) at %s\r\n", alert.PartName, alert.SKU, alert.PartID, alert.Location)
+		fmt.Fprintf(&b, "  Available: %d, reorder point: %d, suggested order: %d\r\n\r\n", alert.Available, alert.ReorderPoint, alert.SuggestedQuantity)
+	}
+	return b.Bytes()
+}
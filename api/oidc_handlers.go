@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// oidcLoginCookie carries the state, nonce and PKCE verifier of a login in
+// progress from /auth/login to /auth/callback.
+const oidcLoginCookie = "pdm_oidc"
+
+type oidcLogin struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ReturnTo  string `json:"return_to"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// safeReturnTo only allows redirects back into the web UI after login.
+func safeReturnTo(returnTo string) string {
+	switch {
+	case returnTo == uiBaseURL || strings.HasPrefix(returnTo, uiBaseURL+"/"):
+		return returnTo
+	case strings.HasPrefix(returnTo, "/") && !strings.HasPrefix(returnTo, "//"):
+		return uiBaseURL + returnTo
+	}
+	return uiBaseURL + "/"
+}
+
+func oidcConfigured(w http.ResponseWriter, auth *Authenticator) bool {
+	if auth == nil || auth.oidc == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// OIDC login Handler
+func LoginHandler(auth *Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !oidcConfigured(w, auth) {
+			return
+		}
+
+		login := oidcLogin{ReturnTo: safeReturnTo(r.URL.Query().Get("return_to")), ExpiresAt: time.Now().Add(10 * time.Minute).Unix()}
+		for _, value := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+			var err error
+			if *value, err = randomHex(32); err != nil {
+				internalError(w, r, err)
+				return
+			}
+		}
+		cookie, err := auth.signValue(login)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		target, err := auth.oidc.AuthCodeURL(login.State, login.Nonce, login.Verifier)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to reach the identity provider", "error", err)
+			http.Error(w, "the identity provider is unavailable", http.StatusBadGateway)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: oidcLoginCookie, Value: cookie, Path: "/auth", MaxAge: 600,
+			HttpOnly: true, Secure: auth.secureCookies, SameSite: http.SameSiteLaxMode})
+		http.Redirect(w, r, target, http.StatusFound)
+	}
+}
+
+// OIDC callback Handler
+func CallbackHandler(auth *Authenticator, repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !oidcConfigured(w, auth) {
+			return
+		}
+		query := r.URL.Query()
+		if message := query.Get("error"); message != "" {
+			http.Error(w, "login failed: "+message+" "+query.Get("error_description"), http.StatusUnauthorized)
+			return
+		}
+
+		var login oidcLogin
+		cookie, err := r.Cookie(oidcLoginCookie)
+		if err != nil || auth.verifyValue(cookie.Value, &login) != nil || time.Now().Unix() >= login.ExpiresAt {
+			http.Error(w, "login has expired, please try again", http.StatusBadRequest)
+			return
+		}
+		if query.Get("state") != login.State {
+			http.Error(w, "login state does not match", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: oidcLoginCookie, Path: "/auth", MaxAge: -1})
+
+		principal, err := auth.oidc.Exchange(query.Get("code"), login.Verifier, login.Nonce)
+		if err != nil {
+			slog.WarnContext(r.Context(), "OIDC login failed", "error", err)
+			http.Error(w, "login failed, please try again", http.StatusUnauthorized)
+			return
+		}
+		id, _, err := repository.CreateSession(r.Context(), principal, auth.sessionTTL)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", MaxAge: int(auth.sessionTTL.Seconds()),
+			HttpOnly: true, Secure: auth.secureCookies, SameSite: http.SameSiteLaxMode})
+		http.Redirect(w, r, login.ReturnTo, http.StatusFound)
+	}
+}
+
+// Logout Handler
+func LogoutHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			if err := repository.DeleteSession(r.Context(), cookie.Value); err != nil {
+				internalError(w, r, err)
+				return
+			}
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Current user Handler
+func MeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := principalFromContext(r.Context())
+		if !ok {
+			http.Error(w, "authentication is disabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			*Principal
+			CSRFToken string `json:"csrf_token,omitempty"`
+		}{principal, principal.csrfToken})
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const outboxBatchSize = 100
+
+// outboxRetention is how long published events stay in the outbox, where
+// clients resuming a change stream can read them. Overridden by
+// OUTBOX_RETENTION.
+var outboxRetention = 7 * 24 * time.Hour
+
+// Publisher delivers outbox events elsewhere. Publish is called with events
+// in outbox order and may see an event again after a failure or restart, so
+// delivery is at least once: publishers must be idempotent or their
+// consumers must ignore event IDs they have already handled.
+type Publisher interface {
+	Name() string
+	Publish(ctx context.Context, event Event) error
+}
+
+// readOutbox returns up to limit events after a sequence number. Writers
+// hold the outbox_lock row from their insert until they commit, so IDs
+// become visible in order: once an event can be read, every event before it
+// either can too or was rolled back, and a gap is never filled later.
+func readOutbox(ctx context.Context, q sqlExecutor, after int64, limit int) ([]Event, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, payload FROM outbox WHERE id > ? ORDER BY id LIMIT ?`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var seq int64
+		var payload []byte
+		if err := rows.Scan(&seq, &payload); err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		event.Seq = seq
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ReadEvents returns up to limit events after a sequence number.
+func (r *Repository) ReadEvents(ctx context.Context, after int64, limit int) ([]Event, error) {
+	return readOutbox(ctx, r.db, after, limit)
+}
+
+// OutboxHead returns the sequence number of the newest event. Clients
+// starting from it miss no event, since no earlier ID can still commit.
+func (r *Repository) OutboxHead(ctx context.Context) (int64, error) {
+	var head int64
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM outbox`).Scan(&head)
+	return head, err
+}
+
+// CursorExpired reports whether events after a sequence number have been
+// pruned from the outbox, so a client at it has to start over.
+func (r *Repository) CursorExpired(ctx context.Context, cursor int64) (bool, error) {
+	if cursor == 0 {
+		return false, nil
+	}
+	var tail int64
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MIN(id), 0) FROM outbox`).Scan(&tail)
+	return tail > cursor+1, err
+}
+
+type outboxSubscriber struct {
+	publisher Publisher
+	durable   bool
+	cursor    int64
+}
+
+// OutboxDispatcher publishes outbox events in order to each registered
+// publisher. Durable publishers keep their position in outbox_cursors and
+// resume from it after a restart, and only one API instance feeds them at a
+// time. Other publishers, such as the in-process Broker, start at the newest
+// event and keep their position in memory.
+type OutboxDispatcher struct {
+	repository  *Repository
+	mu          sync.Mutex
+	subscribers []*outboxSubscriber
+}
+
+func NewOutboxDispatcher(repository *Repository) *OutboxDispatcher {
+	return &OutboxDispatcher{repository: repository}
+}
+
+// Register adds a publisher.
+func (d *OutboxDispatcher) Register(ctx context.Context, publisher Publisher, durable bool) error {
+	subscriber := &outboxSubscriber{publisher: publisher, durable: durable}
+	if durable {
+		if _, err := d.repository.db.ExecContext(ctx, `INSERT IGNORE INTO outbox_cursors (publisher, last_seq) VALUES (?, 0)`, publisher.Name()); err != nil {
+			return err
+		}
+	} else {
+		head, err := d.repository.OutboxHead(ctx)
+		if err != nil {
+			return err
+		}
+		subscriber.cursor = head
+	}
+
+	d.mu.Lock()
+	d.subscribers = append(d.subscribers, subscriber)
+	d.mu.Unlock()
+	return nil
+}
+
+// publishFailure is a publisher's error for one event. It is logged with
+// the request ID of the change the event is about.
+type publishFailure struct {
+	event Event
+	err   error
+}
+
+func (f *publishFailure) Error() string {
+	return fmt.Sprintf("event %d: %v", f.event.Seq, f.err)
+}
+
+func (f *publishFailure) Unwrap() error { return f.err }
+
+// publish hands an event to a publisher with a context that carries the
+// request ID of the change the event is about.
+func publish(ctx context.Context, publisher Publisher, event Event) error {
+	if err := publisher.Publish(withRequestID(ctx, event.RequestID), event); err != nil {
+		return &publishFailure{event: event, err: err}
+	}
+	return nil
+}
+
+// Dispatch publishes the pending events of every publisher. A publisher that
+// fails stops at the failed event and tries it again on the next run.
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var firstErr error
+	for _, subscriber := range d.subscribers {
+		var err error
+		if subscriber.durable {
+			err = d.dispatchDurable(ctx, subscriber.publisher)
+		} else {
+			err = d.dispatchLocal(ctx, subscriber)
+		}
+		if err != nil {
+			logCtx := ctx
+			var failure *publishFailure
+			if errors.As(err, &failure) {
+				logCtx = withRequestID(ctx, failure.event.RequestID)
+			}
+			slog.ErrorContext(logCtx, "Failed to publish outbox events", "publisher", subscriber.publisher.Name(), "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (d *OutboxDispatcher) dispatchLocal(ctx context.Context, subscriber *outboxSubscriber) error {
+	for {
+		events, err := d.repository.ReadEvents(ctx, subscriber.cursor, outboxBatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		for _, event := range events {
+			if err := publish(ctx, subscriber.publisher, event); err != nil {
+				return err
+			}
+			subscriber.cursor = event.Seq
+		}
+	}
+}
+
+// dispatchDurable publishes while holding the publisher's cursor row, and
+// saves the cursor after every event so that a failure only repeats the
+// event that failed.
+func (d *OutboxDispatcher) dispatchDurable(ctx context.Context, publisher Publisher) error {
+	tx, err := d.repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var cursor int64
+	err = tx.QueryRowContext(ctx, `SELECT last_seq FROM outbox_cursors WHERE publisher = ? FOR UPDATE SKIP LOCKED`, publisher.Name()).Scan(&cursor)
+	if err == sql.ErrNoRows {
+		return nil // Another instance is publishing
+	} else if err != nil {
+		return err
+	}
+
+	var publishErr error
+	for publishErr == nil {
+		events, err := readOutbox(ctx, tx, cursor, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			if publishErr = publish(ctx, publisher, event); publishErr != nil {
+				break
+			}
+			cursor = event.Seq
+			if _, err := tx.ExecContext(ctx, `UPDATE outbox_cursors SET last_seq = ?, updated_at = ? WHERE publisher = ?`, cursor, time.Now().UTC(), publisher.Name()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return publishErr
+}
+
+// pruneOutbox removes events past the retention period that every durable
+// publisher has published. It keeps the newest event, so that CursorExpired
+// can tell how far back the outbox reaches.
+func (r *Repository) pruneOutbox(ctx context.Context) error {
+	head, err := r.OutboxHead(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `DELETE FROM outbox WHERE created_at < ? AND id < ? AND id <= (SELECT COALESCE(MIN(last_seq), 0) FROM outbox_cursors)`,
+		time.Now().UTC().Add(-outboxRetention), head)
+	return err
+}
+
+type OutboxPublisherStatus struct {
+	Publisher string `json:"publisher"`
+	Durable   bool   `json:"durable"`
+	Cursor    int64  `json:"cursor"`
+	Lag       int64  `json:"lag"`
+}
+
+type OutboxStatus struct {
+	Head       int64                   `json:"head"`
+	Publishers []OutboxPublisherStatus `json:"publishers"`
+}
+
+// Status reports how far each publisher has got.
+func (d *OutboxDispatcher) Status(ctx context.Context) (OutboxStatus, error) {
+	head, err := d.repository.OutboxHead(ctx)
+	if err != nil {
+		return OutboxStatus{}, err
+	}
+	status := OutboxStatus{Head: head, Publishers: []OutboxPublisherStatus{}}
+
+	d.mu.Lock()
+	subscribers := append([]*outboxSubscriber(nil), d.subscribers...)
+	local := map[*outboxSubscriber]int64{}
+	for _, subscriber := range subscribers {
+		local[subscriber] = subscriber.cursor
+	}
+	d.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		cursor := local[subscriber]
+		if subscriber.durable {
+			if err := d.repository.db.QueryRowContext(ctx, `SELECT last_seq FROM outbox_cursors WHERE publisher = ?`, subscriber.publisher.Name()).Scan(&cursor); err != nil {
+				return OutboxStatus{}, err
+			}
+		}
+		status.Publishers = append(status.Publishers, OutboxPublisherStatus{
+			Publisher: subscriber.publisher.Name(),
+			Durable:   subscriber.durable,
+			Cursor:    cursor,
+			Lag:       max(head-cursor, 0),
+		})
+	}
+	return status, nil
+}
+
+// Start dispatches every interval until stop is closed.
+func (d *OutboxDispatcher) Start(interval time.Duration, stop <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		d.Dispatch(ctx)
+		if time.Since(lastPrune) > time.Hour {
+			if err := d.repository.pruneOutbox(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to prune the outbox", "error", err)
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// WebhookPublisher queues webhook deliveries for outbox events. Queuing is
+// idempotent, so an event published twice is still delivered once per
+// subscription.
+type WebhookPublisher struct {
+	repository *Repository
+}
+
+func (p WebhookPublisher) Name() string { return "webhooks" }
+
+func (p WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	return p.repository.EnqueueWebhooks(ctx, event)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Outbox status Handler
+func OutboxStatusHandler(dispatcher *OutboxDispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := dispatcher.Status(r.Context())
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
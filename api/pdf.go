@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// pdfPage builds a single-page PDF. Templates write the page content stream
+// with the drawing functions below; coordinates are in points from the
+// bottom left of the page.
+type pdfPage struct {
+	width, height float64
+}
+
+func (p *pdfPage) funcs() template.FuncMap {
+	return template.FuncMap{
+		"page": func(width, height float64) string {
+			p.width, p.height = width, height
+			return ""
+		},
+		"text": func(x, y, size float64, s string) string {
+			return pdfText("F1", x, y, size, s)
+		},
+		"bold": func(x, y, size float64, s string) string {
+			return pdfText("F2", x, y, size, s)
+		},
+		"fill": func(gray float64) string {
+			return pdfNum(gray) + " g\n"
+		},
+		"rect": func(x, y, width, height float64) string {
+			return fmt.Sprintf("%s %s %s %s re f\n", pdfNum(x), pdfNum(y), pdfNum(width), pdfNum(height))
+		},
+		"box": func(x, y, width, height, line float64) string {
+			return fmt.Sprintf("%s w %s %s %s %s re S\n", pdfNum(line), pdfNum(x), pdfNum(y), pdfNum(width), pdfNum(height))
+		},
+		"diamond": func(cx, cy, r, line float64) string {
+			return fmt.Sprintf("%s w %s %s m %s %s l %s %s l %s %s l h S\n", pdfNum(line),
+				pdfNum(cx), pdfNum(cy+r), pdfNum(cx+r), pdfNum(cy), pdfNum(cx), pdfNum(cy-r), pdfNum(cx-r), pdfNum(cy))
+		},
+		"code128": func(x, y, height, module float64, data string) (string, error) {
+			modules, err := code128Modules(data)
+			if err != nil {
+				return "", err
+			}
+			var b strings.Builder
+			for i := 0; i < len(modules); {
+				if !modules[i] {
+					i++
+					continue
+				}
+				start := i
+				for i < len(modules) && modules[i] {
+					i++
+				}
+				fmt.Fprintf(&b, "%s %s %s %s re\n", pdfNum(x+float64(start)*module), pdfNum(y), pdfNum(float64(i-start)*module), pdfNum(height))
+			}
+			b.WriteString("f\n")
+			return b.String(), nil
+		},
+	}
+}
+
+func pdfNum(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// pdfText draws a line of text in one of the page fonts. Characters outside
+// Latin-1 are replaced with "?".
+func pdfText(font string, x, y, size float64, s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return fmt.Sprintf("BT /%s %s Tf %s %s Td (%s) Tj ET\n", font, pdfNum(size), pdfNum(x), pdfNum(y), b.String())
+}
+
+// document wraps the content stream in a PDF file using the standard
+// Helvetica fonts.
+func (p *pdfPage) document(content []byte) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> /Contents 4 0 R >>",
+			pdfNum(p.width), pdfNum(p.height)),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Permission names an action that only some roles may perform.
+type Permission string
+
+const (
+	PermRead          Permission = "read"
+	PermWrite         Permission = "write"
+	PermManagePricing Permission = "pricing:write"
+	PermViewCost      Permission = "cost:view"
+	PermManageKeys    Permission = "keys:manage"
+	PermViewAudit     Permission = "audit:view"
+	PermManageHooks   Permission = "webhooks:manage"
+)
+
+// Roles a principal can hold.
+const (
+	RoleViewer   = "viewer"
+	RoleEditor   = "editor"
+	RoleApprover = "approver"
+	RoleAdmin    = "admin"
+)
+
+// rolePermissions maps each role to the permissions it grants.
+var rolePermissions = map[string][]Permission{
+	RoleViewer:   {PermRead},
+	RoleEditor:   {PermRead, PermWrite},
+	RoleApprover: {PermRead, PermWrite, PermManagePricing, PermViewCost},
+	RoleAdmin:    {PermRead, PermWrite, PermManagePricing, PermViewCost, PermManageKeys, PermViewAudit, PermManageHooks},
+}
+
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// routePermissions lists the routes, by method and path template, that need
+// something other than the default: read for GET and HEAD, write otherwise.
+var routePermissions = map[string]Permission{
+	"GET /reports/margins":                        PermViewCost,
+	"POST /shipping/quote":                        PermRead,
+	"POST /shipping/cartonize":                    PermRead,
+	"POST /shipping/compatibility":                PermRead,
+	"PUT /exchange-rates/{currency}":              PermManagePricing,
+	"POST /price-lists":                           PermManagePricing,
+	"PUT /price-lists/{name}":                     PermManagePricing,
+	"DELETE /price-lists/{name}":                  PermManagePricing,
+	"PUT /price-lists/{name}/parts/{id}":          PermManagePricing,
+	"DELETE /price-lists/{name}/parts/{id}":       PermManagePricing,
+	"POST /price-lists/{name}/breaks":             PermManagePricing,
+	"DELETE /price-lists/{name}/breaks/{breakId}": PermManagePricing,
+	"POST /auth/token":                            PermRead,
+	"POST /auth/logout":                           PermRead,
+	"GET /audit":                                  PermViewAudit,
+	"GET /audit/verify":                           PermViewAudit,
+	"GET /audit/export":                           PermViewAudit,
+}
+
+// publicRoutes need no credentials: they sign the user in.
+var publicRoutes = map[string]bool{
+	"GET /auth/login":    true,
+	"GET /auth/callback": true,
+}
+
+// queryTokenRoutes also accept a bearer token in the access_token query
+// parameter, because browsers cannot set headers on EventSource and
+// WebSocket requests.
+var queryTokenRoutes = map[string]bool{
+	"GET /events":    true,
+	"GET /events/ws": true,
+}
+
+// routePermission returns the permission needed to call a route.
+func routePermission(method, path string) Permission {
+	if perm, ok := routePermissions[method+" "+path]; ok {
+		return perm
+	}
+	if path == "/keys" || strings.HasPrefix(path, "/keys/") {
+		return PermManageKeys
+	}
+	if path == "/webhooks" || strings.HasPrefix(path, "/webhooks/") {
+		return PermManageHooks
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return PermRead
+	}
+	return PermWrite
+}
+
+// Principal is the authenticated caller of a request. Via records how it
+// authenticated.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Name    string   `json:"name,omitempty"`
+	Roles   []string `json:"roles"`
+	Via     string   `json:"via"`
+
+	// csrfToken must be sent with mutating requests authenticated by a
+	// session cookie.
+	csrfToken string
+}
+
+// Can reports whether any of the principal's roles grants perm.
+func (p *Principal) Can(perm Permission) bool {
+	for _, role := range p.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == perm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func principalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// hasPermission reports whether the caller of r may perform perm. Every
+// request has a principal, the anonymous one while authentication is
+// disabled, except on public routes; those are denied.
+func hasPermission(r *http.Request, perm Permission) bool {
+	principal, ok := principalFromContext(r.Context())
+	return ok && principal.Can(perm)
+}
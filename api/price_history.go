@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// PriceChange is one point of a price series: the version that set Price and
+// the price it replaced. PreviousPrice is nil for the first version.
+type PriceChange struct {
+	PartID        string `json:"part_id"`
+	PartName      string `json:"part_name,omitempty"`
+	SKU           string `json:"sku,omitempty"`
+	Version       int    `json:"version"`
+	Timestamp     string `json:"timestamp"`
+	Author        string `json:"author"`
+	Price         Money  `json:"price"`
+	PreviousPrice *Money `json:"previous_price,omitempty"`
+	ChangePercent string `json:"change_percent,omitempty"`
+}
+
+// priceChangesQuery selects every version alongside the price of the version
+// before it, so that unchanged versions can be filtered out in SQL.
+const priceChangesQuery = `
+	SELECT part_id, name, sku, version, timestamp, author, price, currency, previous_price, previous_currency FROM (
+		SELECT v.part_id, p.name, COALESCE(p.sku, '') AS sku, v.version, v.timestamp, v.author, v.price, v.currency,
+			LAG(v.price) OVER (PARTITION BY v.part_id ORDER BY v.version) AS previous_price,
+			LAG(v.currency) OVER (PARTITION BY v.part_id ORDER BY v.version) AS previous_currency
+		FROM part_versions v
+		JOIN parts p ON p.id = v.part_id
+	) changes
+	WHERE (previous_price IS NULL OR price <> previous_price OR currency <> previous_currency)
+`
+
+// GetPriceHistory Get the price history of a part from db
+// @Summary      Get price history
+// @Description  List the versions of a part that changed its price, oldest first
+// @Tags         /parts/{id}/price-history
+// @Accept       id
+// @Produce      price changes
+func (r *Repository) GetPriceHistory(ctx context.Context, id string) ([]PriceChange, error) {
+	var exists int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM parts WHERE id = ?`, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("part %w", errNotFound)
+	}
+
+	query := priceChangesQuery + ` AND part_id = ? ORDER BY version`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []PriceChange{}
+	for rows.Next() {
+		change, err := scanPriceChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		change.PartName, change.SKU = "", ""
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// ListPriceChanges List price changes across the catalog
+// @Summary      Price change report
+// @Description  List every price change made in [from, to), excluding initial prices
+// @Tags         /reports/price-changes
+// @Accept       from, to
+// @Produce      price changes
+func (r *Repository) ListPriceChanges(ctx context.Context, from, to time.Time) ([]PriceChange, error) {
+	query := priceChangesQuery + ` AND previous_price IS NOT NULL AND timestamp >= ? AND timestamp < ? ORDER BY timestamp, part_id`
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []PriceChange{}
+	for rows.Next() {
+		change, err := scanPriceChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func scanPriceChange(rows *sql.Rows) (PriceChange, error) {
+	var change PriceChange
+	var previousPrice, previousCurrency sql.NullString
+	if err := rows.Scan(&change.PartID, &change.PartName, &change.SKU, &change.Version, &change.Timestamp, &change.Author,
+		&change.Price, &change.Price.Currency, &previousPrice, &previousCurrency); err != nil {
+		return PriceChange{}, err
+	}
+	if !previousPrice.Valid {
+		return change, nil
+	}
+
+	previous, err := ParseMoney(previousPrice.String, previousCurrency.String)
+	if err != nil {
+		return PriceChange{}, err
+	}
+	change.PreviousPrice = &previous
+	if previous.Currency == change.Price.Currency && previous.Cents != 0 {
+		delta := new(big.Rat).Sub(change.Price.Rat(), previous.Rat())
+		delta.Quo(delta, previous.Rat())
+		delta.Mul(delta, big.NewRat(100, 1))
+		change.ChangePercent = delta.FloatString(2)
+	}
+	return change, nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Price list rules decide the unit price of parts without an override:
+// list keeps the part price, percent_off discounts it by Percent and
+// cost_plus marks the landed cost of the part up by Percent.
+const (
+	RuleList       = "list"
+	RulePercentOff = "percent_off"
+	RuleCostPlus   = "cost_plus"
+)
+
+type PriceList struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Rule        string          `json:"rule"`
+	Percent     json.Number     `json:"percent,omitempty"`
+	Overrides   []PriceOverride `json:"overrides,omitempty"`
+	Breaks      []QuantityBreak `json:"breaks,omitempty"`
+}
+
+type PriceOverride struct {
+	PartID string `json:"part_id"`
+	Price  Money  `json:"price"`
+}
+
+// QuantityBreak discounts the unit price by PercentOff once at least
+// MinQuantity units are quoted. An empty PartID applies to every part on the
+// list; part-specific breaks take precedence.
+type QuantityBreak struct {
+	ID          int64       `json:"id"`
+	PartID      string      `json:"part_id,omitempty"`
+	MinQuantity int         `json:"min_quantity"`
+	PercentOff  json.Number `json:"percent_off"`
+}
+
+type PriceQuote struct {
+	PartID    string   `json:"part_id"`
+	List      string   `json:"list,omitempty"`
+	Quantity  int      `json:"quantity"`
+	ListPrice Money    `json:"list_price"`
+	UnitPrice Money    `json:"unit_price"`
+	Total     Money    `json:"total"`
+	Applied   []string `json:"applied"`
+}
+
+// parsePercent parses a percentage between 0 and max with at most four
+// decimal places, which is what the percent columns store.
+func parsePercent(value json.Number, max int64) (*big.Rat, error) {
+	if value == "" {
+		return new(big.Rat), nil
+	}
+	percent, ok := new(big.Rat).SetString(value.String())
+	if !ok || percent.Sign() < 0 || percent.Cmp(big.NewRat(max, 1)) > 0 {
+		return nil, invalidf("invalid percent %q", value)
+	}
+	if !new(big.Rat).Mul(percent, big.NewRat(10000, 1)).IsInt() {
+		return nil, invalidf("invalid percent %q: at most 4 decimal places", value)
+	}
+	return percent, nil
+}
+
+// applyPercent returns m scaled by (100 + percent) / 100, rounded to cents.
+func applyPercent(m Money, percent *big.Rat) Money {
+	factor := new(big.Rat).Add(big.NewRat(100, 1), percent)
+	factor.Quo(factor, big.NewRat(100, 1))
+	return moneyFromRat(new(big.Rat).Mul(m.Rat(), factor), m.Currency)
+}
+
+func (l PriceList) validate() error {
+	if l.Name == "" {
+		return invalidf("name is required")
+	}
+	switch l.Rule {
+	case RuleList, RulePercentOff:
+		_, err := parsePercent(l.Percent, 100)
+		return err
+	case RuleCostPlus:
+		_, err := parsePercent(l.Percent, 10000)
+		return err
+	default:
+		return invalidf("invalid rule %q", l.Rule)
+	}
+}
+
+// CreatePriceList Creates a price list
+// @Summary      Create price list
+// @Description  Create a named price list with a pricing rule
+// @Tags         /price-lists
+// @Accept       price list
+// @Produce      price list
+func (r *Repository) CreatePriceList(ctx context.Context, list PriceList) (PriceList, error) {
+	if list.Percent == "" {
+		list.Percent = "0"
+	}
+	if err := list.validate(); err != nil {
+		return PriceList{}, err
+	}
+
+	query := `INSERT INTO price_lists (name, description, rule, percent) VALUES (?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, list.Name, list.Description, list.Rule, list.Percent.String())
+	if isDuplicateKey(err) {
+		return PriceList{}, invalidf("price list %q already exists", list.Name)
+	} else if err != nil {
+		return PriceList{}, err
+	}
+	list.ID, err = result.LastInsertId()
+	if err != nil {
+		return PriceList{}, err
+	}
+	list.Overrides, list.Breaks = nil, nil
+	return list, nil
+}
+
+// UpdatePriceList Updates the rule of a price list
+func (r *Repository) UpdatePriceList(ctx context.Context, name string, list PriceList) error {
+	list.Name = name
+	if list.Percent == "" {
+		list.Percent = "0"
+	}
+	if err := list.validate(); err != nil {
+		return err
+	}
+
+	if _, err := r.priceListID(ctx, name); err != nil {
+		return err
+	}
+	query := `UPDATE price_lists SET description = ?, rule = ?, percent = ? WHERE name = ?`
+	_, err := r.db.ExecContext(ctx, query, list.Description, list.Rule, list.Percent.String(), name)
+	return err
+}
+
+// DeletePriceList Deletes a price list with its overrides and breaks
+func (r *Repository) DeletePriceList(ctx context.Context, name string) error {
+	id, err := r.priceListID(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"price_list_breaks", "price_list_overrides"} {
+		if _, err := r.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE price_list_id = ?`, id); err != nil {
+			return err
+		}
+	}
+	_, err = r.db.ExecContext(ctx, `DELETE FROM price_lists WHERE id = ?`, id)
+	return err
+}
+
+// ListPriceLists List price lists without their overrides and breaks
+func (r *Repository) ListPriceLists(ctx context.Context) ([]PriceList, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, COALESCE(description, ''), rule, percent FROM price_lists ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []PriceList{}
+	for rows.Next() {
+		var list PriceList
+		var percent string
+		if err := rows.Scan(&list.ID, &list.Name, &list.Description, &list.Rule, &percent); err != nil {
+			return nil, err
+		}
+		list.Percent = json.Number(percent)
+		lists = append(lists, list)
+	}
+	return lists, rows.Err()
+}
+
+// GetPriceList Get a price list with its overrides and breaks
+// @Summary      Get price list
+// @Description  Get a price list by name with per-part overrides and quantity breaks
+// @Tags         /price-lists/{name}
+// @Accept       name
+// @Produce      price list
+func (r *Repository) GetPriceList(ctx context.Context, name string) (PriceList, error) {
+	var list PriceList
+	var percent string
+	query := `SELECT id, name, COALESCE(description, ''), rule, percent FROM price_lists WHERE name = ?`
+	if err := r.db.QueryRowContext(ctx, query, name).Scan(&list.ID, &list.Name, &list.Description, &list.Rule, &percent); err != nil {
+		if err == sql.ErrNoRows {
+			return PriceList{}, fmt.Errorf("price list %w", errNotFound)
+		}
+		return PriceList{}, err
+	}
+	list.Percent = json.Number(percent)
+
+	rows, err := r.db.QueryContext(ctx, `SELECT part_id, price, currency FROM price_list_overrides WHERE price_list_id = ? ORDER BY part_id`, list.ID)
+	if err != nil {
+		return PriceList{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var override PriceOverride
+		if err := rows.Scan(&override.PartID, &override.Price, &override.Price.Currency); err != nil {
+			return PriceList{}, err
+		}
+		list.Overrides = append(list.Overrides, override)
+	}
+	if err := rows.Err(); err != nil {
+		return PriceList{}, err
+	}
+
+	list.Breaks, err = r.listQuantityBreaks(ctx, list.ID, "")
+	if err != nil {
+		return PriceList{}, err
+	}
+	return list, nil
+}
+
+// hideMarkup clears the percent of a cost_plus list, from which the landed
+// cost of any part quoted on it could be worked out.
+func (l *PriceList) hideMarkup() {
+	if l.Rule == RuleCostPlus {
+		l.Percent = ""
+	}
+}
+
+func (r *Repository) priceListID(ctx context.Context, name string) (int64, error) {
+	var id int64
+	if err := r.db.QueryRowContext(ctx, `SELECT id FROM price_lists WHERE name = ?`, name).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("price list %w", errNotFound)
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// SetPriceOverride Sets the price of a part on a price list
+func (r *Repository) SetPriceOverride(ctx context.Context, name, partID string, price Money) error {
+	listID, err := r.priceListID(ctx, name)
+	if err != nil {
+		return err
+	}
+	if price.Cents < 0 {
+		return invalidf("price must not be negative")
+	}
+	if price.Cents > maxCents {
+		return invalidf("price must not be above %s", Money{Cents: maxCents}.Amount())
+	}
+	if price.Currency == "" {
+		price.Currency = BaseCurrency
+	}
+	if _, err := r.GetPart(ctx, partID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO price_list_overrides (price_list_id, part_id, price, currency) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE price = VALUES(price), currency = VALUES(currency)
+	`
+	_, err = r.db.ExecContext(ctx, query, listID, partID, price, price.Currency)
+	return err
+}
+
+// DeletePriceOverride Removes the price of a part from a price list
+func (r *Repository) DeletePriceOverride(ctx context.Context, name, partID string) error {
+	listID, err := r.priceListID(ctx, name)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `DELETE FROM price_list_overrides WHERE price_list_id = ? AND part_id = ?`, listID, partID)
+	return err
+}
+
+// AddQuantityBreak Adds a quantity break to a price list
+func (r *Repository) AddQuantityBreak(ctx context.Context, name string, qb QuantityBreak) (QuantityBreak, error) {
+	listID, err := r.priceListID(ctx, name)
+	if err != nil {
+		return QuantityBreak{}, err
+	}
+	if qb.MinQuantity < 1 {
+		return QuantityBreak{}, invalidf("min_quantity must be at least 1")
+	}
+	if _, err := parsePercent(qb.PercentOff, 100); err != nil {
+		return QuantityBreak{}, err
+	}
+
+	var partID interface{}
+	if qb.PartID != "" {
+		if _, err := r.GetPart(ctx, qb.PartID); err != nil {
+			return QuantityBreak{}, err
+		}
+		partID = qb.PartID
+	}
+	query := `INSERT INTO price_list_breaks (price_list_id, part_id, min_quantity, percent_off) VALUES (?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query, listID, partID, qb.MinQuantity, qb.PercentOff.String())
+	if err != nil {
+		return QuantityBreak{}, err
+	}
+	qb.ID, err = result.LastInsertId()
+	if err != nil {
+		return QuantityBreak{}, err
+	}
+	return qb, nil
+}
+
+// DeleteQuantityBreak Removes a quantity break from a price list
+func (r *Repository) DeleteQuantityBreak(ctx context.Context, name string, id int64) error {
+	listID, err := r.priceListID(ctx, name)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `DELETE FROM price_list_breaks WHERE price_list_id = ? AND id = ?`, listID, id)
+	return err
+}
+
+// listQuantityBreaks returns the breaks of a list, restricted to those that
+// apply to partID when it is not empty.
+func (r *Repository) listQuantityBreaks(ctx context.Context, listID int64, partID string) ([]QuantityBreak, error) {
+	query := `SELECT id, COALESCE(part_id, ''), min_quantity, percent_off FROM price_list_breaks WHERE price_list_id = ?`
+	args := []interface{}{listID}
+	if partID != "" {
+		query += ` AND (part_id IS NULL OR part_id = ?)`
+		args = append(args, partID)
+	}
+	query += ` ORDER BY min_quantity`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breaks []QuantityBreak
+	for rows.Next() {
+		var qb QuantityBreak
+		var percent string
+		if err := rows.Scan(&qb.ID, &qb.PartID, &qb.MinQuantity, &percent); err != nil {
+			return nil, err
+		}
+		qb.PercentOff = json.Number(percent)
+		breaks = append(breaks, qb)
+	}
+	return breaks, rows.Err()
+}
+
+// QuotePrice Quotes the price of a part
+// @Summary      Quote price
+// @Description  Quote the unit and total price of a part on a price list for a quantity
+// @Tags         /parts/{id}/price
+// @Accept       id, list, quantity, whether the caller may view costs
+// @Produce      price quote
+func (r *Repository) QuotePrice(ctx context.Context, id, listName string, quantity int, viewCost bool) (PriceQuote, error) {
+	if quantity < 1 {
+		return PriceQuote{}, invalidf("quantity must be at least 1")
+	}
+	part, err := r.GetPart(ctx, id)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	quote := PriceQuote{PartID: id, List: listName, Quantity: quantity, ListPrice: part.Price, UnitPrice: part.Price, Applied: []string{}}
+	if listName != "" {
+		list, err := r.GetPriceList(ctx, listName)
+		if err != nil {
+			return PriceQuote{}, err
+		}
+		if err := quote.applyList(part, list, viewCost); err != nil {
+			return PriceQuote{}, err
+		}
+
+		breaks, err := r.listQuantityBreaks(ctx, list.ID, id)
+		if err != nil {
+			return PriceQuote{}, err
+		}
+		quote.applyBreaks(breaks)
+	}
+
+	quote.Total = moneyFromRat(new(big.Rat).Mul(quote.UnitPrice.Rat(), big.NewRat(int64(quantity), 1)), quote.UnitPrice.Currency)
+	return quote, nil
+}
+
+// applyList prices the part on list. A cost_plus price gives away the landed
+// cost, so only callers who may view costs get one.
+func (q *PriceQuote) applyList(part Part, list PriceList, viewCost bool) error {
+	for _, override := range list.Overrides {
+		if override.PartID == part.ID {
+			q.UnitPrice = override.Price
+			q.Applied = append(q.Applied, fmt.Sprintf("%s override %s", list.Name, override.Price))
+			return nil
+		}
+	}
+
+	percent, err := parsePercent(list.Percent, 10000)
+	if err != nil {
+		return err
+	}
+	switch list.Rule {
+	case RulePercentOff:
+		q.UnitPrice = applyPercent(part.Price, new(big.Rat).Neg(percent))
+		q.Applied = append(q.Applied, fmt.Sprintf("%s %s%% off list", list.Name, list.Percent))
+	case RuleCostPlus:
+		if !viewCost {
+			return fmt.Errorf("%w to view costs, which cost-plus prices are based on", errForbidden)
+		}
+		landed, ok := part.landedCost()
+		if !ok {
+			return invalidf("part has no cost for cost-plus pricing")
+		}
+		q.UnitPrice = applyPercent(landed, percent)
+		q.Applied = append(q.Applied, fmt.Sprintf("%s cost plus %s%%", list.Name, list.Percent))
+	}
+	return nil
+}
+
+// applyBreaks applies the highest break reached by the quantity, preferring
+// breaks specific to the part over list-wide ones.
+func (q *PriceQuote) applyBreaks(breaks []QuantityBreak) {
+	var best *QuantityBreak
+	for i, qb := range breaks {
+		if qb.MinQuantity > q.Quantity {
+			continue
+		}
+		if best == nil || betterBreak(qb, *best) {
+			best = &breaks[i]
+		}
+	}
+	if best == nil {
+		return
+	}
+
+	percent, err := parsePercent(best.PercentOff, 100)
+	if err != nil {
+		return
+	}
+	q.UnitPrice = applyPercent(q.UnitPrice, new(big.Rat).Neg(percent))
+	q.Applied = append(q.Applied, fmt.Sprintf("%s%% off for %d or more", best.PercentOff, best.MinQuantity))
+}
+
+func betterBreak(a, b QuantityBreak) bool {
+	if (a.PartID != "") != (b.PartID != "") {
+		return a.PartID != ""
+	}
+	return a.MinQuantity > b.MinQuantity
+}
+
+// convert returns the quote in currency. The total is recomputed from the
+// converted unit price so that it stays exactly unit price times quantity.
+func (q PriceQuote) convert(table RateTable, currency string) (PriceQuote, error) {
+	listPrice, err := table.Convert(q.ListPrice, currency)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+	unitPrice, err := table.Convert(q.UnitPrice, currency)
+	if err != nil {
+		return PriceQuote{}, err
+	}
+
+	q.ListPrice, q.UnitPrice = listPrice, unitPrice
+	q.Total = moneyFromRat(new(big.Rat).Mul(unitPrice.Rat(), big.NewRat(int64(q.Quantity), 1)), currency)
+	return q, nil
+}
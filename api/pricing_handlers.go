@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// List price lists Handler
+func ListPriceListsHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lists, err := repository.ListPriceLists(r.Context())
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		if !hasPermission(r, PermViewCost) {
+			for i := range lists {
+				lists[i].hideMarkup()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lists)
+	}
+}
+
+// Create price list Handler
+func CreatePriceListHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var list PriceList
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := repository.CreatePriceList(r.Context(), list)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// Get price list Handler
+func GetPriceListHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := repository.GetPriceList(r.Context(), mux.Vars(r)["name"])
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if !hasPermission(r, PermViewCost) {
+			list.hideMarkup()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}
+}
+
+// Update price list Handler
+func UpdatePriceListHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var list PriceList
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := repository.UpdatePriceList(r.Context(), mux.Vars(r)["name"], list); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Delete price list Handler
+func DeletePriceListHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := repository.DeletePriceList(r.Context(), mux.Vars(r)["name"]); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Set price list override Handler
+func SetPriceOverrideHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var override PriceOverride
+		if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := repository.SetPriceOverride(r.Context(), vars["name"], vars["id"], override.Price); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Delete price list override Handler
+func DeletePriceOverrideHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := repository.DeletePriceOverride(r.Context(), vars["name"], vars["id"]); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Add quantity break Handler
+func AddQuantityBreakHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var qb QuantityBreak
+		if err := json.NewDecoder(r.Body).Decode(&qb); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		qb, err := repository.AddQuantityBreak(r.Context(), mux.Vars(r)["name"], qb)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(qb)
+	}
+}
+
+// Delete quantity break Handler
+func DeleteQuantityBreakHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["breakId"], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := repository.DeleteQuantityBreak(r.Context(), vars["name"], id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Quote Part price Handler
+func QuotePriceHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		quantity := 1
+		if value := q.Get("qty"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			quantity = n
+		}
+
+		quote, err := repository.QuotePrice(r.Context(), mux.Vars(r)["id"], q.Get("list"), quantity, hasPermission(r, PermViewCost))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		if currency := q.Get("currency"); currency != "" {
+			table, err := repository.RateTable(r.Context())
+			if err != nil {
+				internalError(w, r, err)
+				return
+			}
+			if quote, err = quote.convert(table, currency); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(quote)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Alert statuses. An alert stays open until it is acknowledged, and is
+// resolved by the evaluator once available stock is back above the reorder point.
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+type ReorderPoint struct {
+	PartID       string `json:"part_id"`
+	Location     string `json:"location"`
+	ReorderPoint int    `json:"reorder_point"`
+	MaxQuantity  int    `json:"max_quantity"`
+}
+
+type StockAlert struct {
+	ID                int64  `json:"id"`
+	PartID            string `json:"part_id"`
+	PartName          string `json:"part_name"`
+	SKU               string `json:"sku"`
+	Location          string `json:"location"`
+	Available         int    `json:"available"`
+	ReorderPoint      int    `json:"reorder_point"`
+	SuggestedQuantity int    `json:"suggested_quantity"`
+	Status            string `json:"status"`
+	CreatedAt         string `json:"created_at"`
+	AcknowledgedAt    string `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy    string `json:"acknowledged_by,omitempty"`
+	NotifiedAt        string `json:"notified_at,omitempty"`
+}
+
+// SetReorderPoint Sets the reorder point of a part at a location
+// @Summary      Set reorder point
+// @Description  Set min (reorder point) and max quantities of a part at a location
+// @Tags         /parts/{id}/reorder/{location}
+// @Accept       id, location, reorder point
+// @Produce      reorder point
+func (r *Repository) SetReorderPoint(ctx context.Context, point ReorderPoint) (ReorderPoint, error) {
+	if point.Location == "" {
+		return ReorderPoint{}, invalidf("location is required")
+	}
+	if point.ReorderPoint < 0 {
+		return ReorderPoint{}, invalidf("reorder_point must not be negative")
+	}
+	if point.MaxQuantity <= point.ReorderPoint {
+		return ReorderPoint{}, invalidf("max_quantity must be greater than reorder_point")
+	}
+
+	var exists int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM parts WHERE id = ?`, point.PartID).Scan(&exists); err != nil {
+		return ReorderPoint{}, err
+	}
+	if exists == 0 {
+		return ReorderPoint{}, fmt.Errorf("part %w", errNotFound)
+	}
+
+	query := `
+		INSERT INTO reorder_points (part_id, location, reorder_point, max_quantity)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE reorder_point = VALUES(reorder_point), max_quantity = VALUES(max_quantity)
+	`
+	if _, err := r.db.ExecContext(ctx, query, point.PartID, point.Location, point.ReorderPoint, point.MaxQuantity); err != nil {
+		return ReorderPoint{}, err
+	}
+	return point, nil
+}
+
+// ListReorderPoints List reorder points of a part from db
+// @Summary      List reorder points
+// @Description  List reorder points of a part per location
+// @Tags         /parts/{id}/reorder
+// @Accept       id
+// @Produce      reorder points
+func (r *Repository) ListReorderPoints(ctx context.Context, id string) ([]ReorderPoint, error) {
+	query := `SELECT part_id, location, reorder_point, max_quantity FROM reorder_points WHERE part_id = ? ORDER BY location`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []ReorderPoint{}
+	for rows.Next() {
+		var point ReorderPoint
+		if err := rows.Scan(&point.PartID, &point.Location, &point.ReorderPoint, &point.MaxQuantity); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// DeleteReorderPoint Deletes the reorder point of a part at a location
+func (r *Repository) DeleteReorderPoint(ctx context.Context, id, location string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM reorder_points WHERE part_id = ? AND location = ?`, id, location)
+	return err
+}
+
+// EvaluateReorderPoints raises an alert for every reorder point whose
+// available stock is at or below the reorder point and has no unresolved
+// alert yet, and resolves alerts whose stock has recovered. It returns the
+// alerts raised by this run.
+func (r *Repository) EvaluateReorderPoints(ctx context.Context) ([]StockAlert, error) {
+	query := `
+		SELECT rp.part_id, rp.location, rp.reorder_point, rp.max_quantity, COALESCE(s.on_hand - s.reserved, 0)
+		FROM reorder_points rp
+		LEFT JOIN part_stock s ON s.part_id = rp.part_id AND s.location = rp.location
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	type level struct {
+		point     ReorderPoint
+		available int
+	}
+	var levels []level
+	for rows.Next() {
+		var l level
+		if err := rows.Scan(&l.point.PartID, &l.point.Location, &l.point.ReorderPoint, &l.point.MaxQuantity, &l.available); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		levels = append(levels, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var raised []int64
+	for _, l := range levels {
+		if l.available > l.point.ReorderPoint {
+			resolveQuery := `UPDATE stock_alerts SET status = ? WHERE part_id = ? AND location = ? AND status <> ?`
+			result, err := r.db.ExecContext(ctx, resolveQuery, AlertResolved, l.point.PartID, l.point.Location, AlertResolved)
+			if err != nil {
+				return nil, err
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return nil, err
+			} else if n > 0 {
+				details := map[string]interface{}{"location": l.point.Location, "available": l.available, "resolved": n}
+				if err := r.appendSystemAudit(ctx, "system:reorder", "resolve alerts", "parts", l.point.PartID, details); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		id, err := r.raiseAlert(ctx, l.point, l.available)
+		if err != nil {
+			return nil, err
+		}
+		if id == 0 {
+			continue
+		}
+		raised = append(raised, id)
+
+		details := map[string]interface{}{"alert_id": id, "location": l.point.Location, "available": l.available, "reorder_point": l.point.ReorderPoint}
+		if err := r.appendSystemAudit(ctx, "system:reorder", "raise alert", "parts", l.point.PartID, details); err != nil {
+			return nil, err
+		}
+	}
+
+	alerts := []StockAlert{}
+	for _, id := range raised {
+		alert, err := r.GetAlert(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// raiseAlert opens an alert for a reorder point unless one is unresolved,
+// and returns its ID, or 0 if none was raised. The reorder point's row is
+// locked while checking, so that the background evaluator and POST
+// /alerts/evaluate cannot both raise one.
+func (r *Repository) raiseAlert(ctx context.Context, point ReorderPoint, available int) (int64, error) {
+	var id int64
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var locked int
+		lockQuery := `SELECT 1 FROM reorder_points WHERE part_id = ? AND location = ? FOR UPDATE`
+		err := tx.QueryRowContext(ctx, lockQuery, point.PartID, point.Location).Scan(&locked)
+		if err == sql.ErrNoRows {
+			return nil // Deleted since it was read
+		} else if err != nil {
+			return err
+		}
+
+		var unresolved int
+		countQuery := `SELECT COUNT(*) FROM stock_alerts WHERE part_id = ? AND location = ? AND status <> ?`
+		if err := tx.QueryRowContext(ctx, countQuery, point.PartID, point.Location, AlertResolved).Scan(&unresolved); err != nil {
+			return err
+		}
+		if unresolved > 0 {
+			return nil
+		}
+
+		insertQuery := `
+			INSERT INTO stock_alerts (part_id, location, available, reorder_point, suggested_quantity, status, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`
+		result, err := tx.ExecContext(ctx, insertQuery, point.PartID, point.Location, available, point.ReorderPoint, point.MaxQuantity-available, AlertOpen, time.Now())
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	return id, err
+}
+
+const alertColumns = `a.id, a.part_id, p.name, COALESCE(p.sku, ''), a.location, a.available, a.reorder_point, a.suggested_quantity, a.status, a.created_at, COALESCE(a.acknowledged_at, ''), a.acknowledged_by, COALESCE(a.notified_at, '')`
+
+func scanAlert(scan func(dest ...interface{}) error) (StockAlert, error) {
+	var alert StockAlert
+	err := scan(&alert.ID, &alert.PartID, &alert.PartName, &alert.SKU, &alert.Location, &alert.Available, &alert.ReorderPoint, &alert.SuggestedQuantity, &alert.Status, &alert.CreatedAt, &alert.AcknowledgedAt, &alert.AcknowledgedBy, &alert.NotifiedAt)
+	return alert, err
+}
+
+// GetAlert Get a stock alert from db
+func (r *Repository) GetAlert(ctx context.Context, id int64) (StockAlert, error) {
+	query := `SELECT ` + alertColumns + ` FROM stock_alerts a JOIN parts p ON p.id = a.part_id WHERE a.id = ?`
+	alert, err := scanAlert(r.db.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		return StockAlert{}, fmt.Errorf("alert %w", errNotFound)
+	} else if err != nil {
+		return StockAlert{}, err
+	}
+	return alert, nil
+}
+
+// ListAlerts List stock alerts from db
+// @Summary      List alerts
+// @Description  List low-stock alerts, newest first, optionally by status
+// @Tags         /alerts
+// @Accept       status
+// @Produce      alerts
+func (r *Repository) ListAlerts(ctx context.Context, status string) ([]StockAlert, error) {
+	query := `SELECT ` + alertColumns + ` FROM stock_alerts a JOIN parts p ON p.id = a.part_id`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE a.status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY a.id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []StockAlert{}
+	for rows.Next() {
+		alert, err := scanAlert(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// AcknowledgeAlert Acknowledges an open stock alert
+// @Summary      Acknowledge alert
+// @Description  Mark an open alert as acknowledged
+// @Tags         /alerts/{id}/acknowledge
+// @Accept       id, acknowledged by
+// @Produce      alert
+func (r *Repository) AcknowledgeAlert(ctx context.Context, id int64, by string) (StockAlert, error) {
+	query := `UPDATE stock_alerts SET status = ?, acknowledged_at = ?, acknowledged_by = ? WHERE id = ? AND status = ?`
+	result, err := r.db.ExecContext(ctx, query, AlertAcknowledged, time.Now(), by, id, AlertOpen)
+	if err != nil {
+		return StockAlert{}, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return StockAlert{}, err
+	}
+	if affected == 0 {
+		return StockAlert{}, fmt.Errorf("open alert %w", errNotFound)
+	}
+	return r.GetAlert(ctx, id)
+}
+
+// NotifyPendingAlerts hands the open alerts that have not been sent yet to
+// the notifier and marks them as sent, so that an alert whose notification
+// failed is sent again by the next call. The alerts stay locked while they
+// are sent, so that concurrent callers do not send them twice. It returns
+// the alerts that were sent.
+func (r *Repository) NotifyPendingAlerts(ctx context.Context, notifier Notifier) ([]StockAlert, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + alertColumns + ` FROM stock_alerts a JOIN parts p ON p.id = a.part_id
+		WHERE a.status = ? AND a.notified_at IS NULL ORDER BY a.id FOR UPDATE OF a SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, query, AlertOpen)
+	if err != nil {
+		return nil, err
+	}
+	alerts := []StockAlert{}
+	var ids []interface{}
+	for rows.Next() {
+		alert, err := scanAlert(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+		ids = append(ids, alert.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(alerts) == 0 {
+		return alerts, nil
+	}
+
+	if err := notifier.Notify(ctx, alerts); err != nil {
+		return nil, err
+	}
+	notifiedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	updateQuery := `UPDATE stock_alerts SET notified_at = ? WHERE id IN (` + placeholders(len(ids)) + `)`
+	if _, err := tx.ExecContext(ctx, updateQuery, append([]interface{}{notifiedAt}, ids...)...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	for i := range alerts {
+		alerts[i].NotifiedAt = notifiedAt
+	}
+	return alerts, nil
+}
+
+// StartReorderEvaluator evaluates reorder points every interval and hands
+// the open alerts not sent yet to the notifier. It runs until stop is closed.
+func StartReorderEvaluator(repository *Repository, notifier Notifier, interval time.Duration, stop <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := repository.EvaluateReorderPoints(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to evaluate reorder points", "error", err)
+		}
+		if _, err := repository.NotifyPendingAlerts(ctx, notifier); err != nil {
+			slog.ErrorContext(ctx, "Failed to send low-stock alerts", "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
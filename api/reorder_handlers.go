@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Set reorder point Handler
+func SetReorderPointHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var point ReorderPoint
+		if err := json.NewDecoder(r.Body).Decode(&point); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		point.PartID = vars["id"]
+		point.Location = vars["location"]
+
+		point, err := repository.SetReorderPoint(r.Context(), point)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(point)
+	}
+}
+
+// List reorder points Handler
+func ListReorderPointsHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		points, err := repository.ListReorderPoints(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(points)
+	}
+}
+
+// Delete reorder point Handler
+func DeleteReorderPointHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := repository.DeleteReorderPoint(r.Context(), vars["id"], vars["location"]); err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// List alerts Handler
+func ListAlertsHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", AlertOpen, AlertAcknowledged, AlertResolved:
+		default:
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+
+		alerts, err := repository.ListAlerts(r.Context(), status)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alerts)
+	}
+}
+
+// Acknowledge alert Handler
+func AcknowledgeAlertHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var body struct {
+			AcknowledgedBy string `json:"acknowledged_by"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		alert, err := repository.AcknowledgeAlert(r.Context(), id, body.AcknowledgedBy)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alert)
+	}
+}
+
+// AlertEvaluation is the result of POST /alerts/evaluate: the alerts raised,
+// and why notifications could not be sent if they could not.
+type AlertEvaluation struct {
+	Alerts      []StockAlert `json:"alerts"`
+	NotifyError string       `json:"notify_error,omitempty"`
+}
+
+// Evaluate reorder points Handler
+func EvaluateAlertsHandler(repository *Repository, notifier Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alerts, err := repository.EvaluateReorderPoints(r.Context())
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		// The raised alerts are saved either way; unsent ones are sent again
+		// by the next evaluation
+		evaluation := AlertEvaluation{Alerts: alerts}
+		status := http.StatusOK
+		sent, err := repository.NotifyPendingAlerts(r.Context(), notifier)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to send reorder alerts", "error", err)
+			evaluation.NotifyError = "failed to send the alert notifications"
+			status = http.StatusBadGateway
+		}
+		for _, alert := range sent {
+			for i := range evaluation.Alerts {
+				if evaluation.Alerts[i].ID == alert.ID {
+					evaluation.Alerts[i].NotifiedAt = alert.NotifiedAt
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(evaluation)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"sync"
 	"time"
@@ -16,8 +18,12 @@ type Part struct {
 	Name        string            `json:"name"`
 	Images      []string          `json:"images"`
 	SKU         string            `json:"sku"`
+	GTIN        string            `json:"gtin,omitempty"`
 	Description string            `json:"description"`
-	Price       float64           `json:"price"`
+	Price       Money             `json:"price"`
+	Cost        *Money            `json:"cost,omitempty"`
+	LandedCosts []CostComponent   `json:"landed_costs,omitempty"`
+	Margin      *Margin           `json:"margin,omitempty"`
 	Attributes  map[string]string `json:"attributes"`
 	FitmentData []string          `json:"fitment_data"`
 	Location    string            `json:"location"`
@@ -25,19 +31,53 @@ type Part struct {
 	Metadata    map[string]string `json:"metadata"`
 	Version     int               `json:"version"`
 	Timestamp   string            `json:"timestamp"`
+
+	// Author and RequestID are set by the server; ChangeComment is the
+	// client's reason for the change. They are stored with the version.
+	Author        string `json:"author,omitempty"`
+	ChangeComment string `json:"change_comment,omitempty"`
+	RequestID     string `json:"request_id,omitempty"`
+
+	// BaseVersion is the version a client edited, when it edited offline.
+	// The change is only saved if that is still the newest version.
+	BaseVersion int `json:"base_version,omitempty"`
+}
+
+// normalizeCurrencies fills in currencies left empty by the client: the base
+// currency for the price, and the price currency for the cost and its
+// landed-cost components.
+func (p *Part) normalizeCurrencies() {
+	if p.Price.Currency == "" {
+		p.Price.Currency = BaseCurrency
+	}
+	if p.Cost != nil && p.Cost.Currency == "" {
+		p.Cost.Currency = p.Price.Currency
+	}
+	for i := range p.LandedCosts {
+		if p.LandedCosts[i].Amount.Currency == "" {
+			p.LandedCosts[i].Amount.Currency = p.Price.Currency
+		}
+	}
 }
 
 type ShipmentInfo struct {
-	Weight    float64 `json:"weight"`
-	Size      string  `json:"size"`
-	Hazardous bool    `json:"hazardous"`
-	Fragile   bool    `json:"fragile"`
+	Weight            float64              `json:"weight"`
+	WeightUnit        string               `json:"weight_unit"`
+	Size              string               `json:"size"`
+	Dimensions        *Dimensions          `json:"dimensions,omitempty"`
+	DimensionalWeight map[string]DimWeight `json:"dimensional_weight,omitempty"`
+	Hazardous         bool                 `json:"hazardous"`
+	Hazmat            *HazmatInfo          `json:"hazmat,omitempty"`
+	Fragile           bool                 `json:"fragile"`
 }
 
 type PartVersion struct {
-	Version   int    `json:"version"`
-	Timestamp string `json:"timestamp"`
-	Part      Part   `json:"part"`
+	Version       int    `json:"version"`
+	Timestamp     string `json:"timestamp"`
+	Author        string `json:"author"`
+	ChangeComment string `json:"change_comment,omitempty"`
+	RequestID     string `json:"request_id,omitempty"`
+	Part          Part   `json:"part"`
 }
 
 type Repository struct {
@@ -57,64 +97,189 @@ func NewRepository(db *sql.DB) *Repository {
 	}
 }
 
-// CreatePart Creates Part stores it in db
-// @Summary      Creates Part
-// @Description  Creates Part stores it in db
-// @Tags         parts
-// @Accept       part struct
-// @Produce      map[]
-func (r *Repository) CreatePart(part Part) (string, error) {
-	// Check if part with same details exists
-	existingPart, err := r.findPartByDetails(part)
-	if err == nil && existingPart.ID != "" {
-		if err := r.DeletePart(existingPart.ID); err != nil {
-			return "", err
-		}
-	}
+// partDataColumns lists the versioned columns shared by parts and
+// part_versions, in the order used by partValues and scanPart.
+const partDataColumns = `name, images, sku, gtin, description, price, currency, cost, cost_currency, landed_costs, attributes, fitment_data, location, shipment, metadata`
 
-	// Marshal JSON fields
+const (
+	partColumns    = `id, ` + partDataColumns
+	versionColumns = `part_id, ` + partDataColumns
+)
+
+// partValues returns the values of partDataColumns for part, marshalling the
+// JSON fields.
+func partValues(part Part) ([]interface{}, error) {
 	images, err := json.Marshal(part.Images)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	landedCosts, err := json.Marshal(part.LandedCosts)
+	if err != nil {
+		return nil, err
 	}
 	attributes, err := json.Marshal(part.Attributes)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	fitmentData, err := json.Marshal(part.FitmentData)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	// Dimensional weight depends on carrier configuration, so it is computed on read
+	part.Shipment.DimensionalWeight = nil
 	shipment, err := json.Marshal(part.Shipment)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	metadata, err := json.Marshal(part.Metadata)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	var costCurrency sql.NullString
+	if part.Cost != nil {
+		costCurrency = sql.NullString{String: part.Cost.Currency, Valid: true}
+	}
+	return []interface{}{part.Name, images, part.SKU, part.GTIN, part.Description, part.Price, part.Price.Currency, part.Cost, costCurrency,
+		landedCosts, attributes, fitmentData, part.Location, shipment, metadata}, nil
+}
+
+// scanPart reads a row selected with partColumns or versionColumns.
+func scanPart(scan func(dest ...interface{}) error) (Part, error) {
+	var part Part
+	var cost, costCurrency sql.NullString
+	var images, landedCosts, attributes, fitmentData, shipment, metadata []byte
+	if err := scan(&part.ID, &part.Name, &images, &part.SKU, &part.GTIN, &part.Description, &part.Price, &part.Price.Currency, &cost, &costCurrency,
+		&landedCosts, &attributes, &fitmentData, &part.Location, &shipment, &metadata); err != nil {
+		return Part{}, err
+	}
+
+	if cost.Valid {
+		parsed, err := ParseMoney(cost.String, costCurrency.String)
+		if err != nil {
+			return Part{}, err
+		}
+		part.Cost = &parsed
+	}
+	if err := json.Unmarshal(images, &part.Images); err != nil {
+		return Part{}, err
+	}
+	if landedCosts != nil {
+		if err := json.Unmarshal(landedCosts, &part.LandedCosts); err != nil {
+			return Part{}, err
+		}
+	}
+	if err := json.Unmarshal(attributes, &part.Attributes); err != nil {
+		return Part{}, err
 	}
+	if err := json.Unmarshal(fitmentData, &part.FitmentData); err != nil {
+		return Part{}, err
+	}
+	if err := json.Unmarshal(shipment, &part.Shipment); err != nil {
+		return Part{}, err
+	}
+	if err := json.Unmarshal(metadata, &part.Metadata); err != nil {
+		return Part{}, err
+	}
+
+	return part, nil
+}
 
-	// Insert part into the parts table
-	query := `
-		INSERT INTO parts (name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-	result, err := r.db.Exec(query, part.Name, images, part.SKU, part.Description, part.Price, attributes, fitmentData, part.Location, shipment, metadata)
+// latestVersionColumn selects the newest version number of a row of parts.
+const latestVersionColumn = `(SELECT COALESCE(MAX(version), 0) FROM part_versions WHERE part_versions.part_id = parts.id)`
+
+// scanPartWithVersion reads a row selected with partColumns and then
+// latestVersionColumn.
+func scanPartWithVersion(scan func(dest ...interface{}) error) (Part, error) {
+	var version int
+	part, err := scanPart(func(dest ...interface{}) error {
+		return scan(append(dest, &version)...)
+	})
+	part.Version = version
+	return part, err
+}
+
+// placeholders returns n comma-separated SQL placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sqlExecutor is implemented by *sql.DB and *sql.Tx, so that queries can
+// run on their own or as part of a transaction.
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn in a transaction and commits it if fn succeeds.
+func (r *Repository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreatePart Creates Part stores it in db
+// @Summary      Creates Part
+// @Description  Creates Part stores it in db
+// @Tags         parts
+// @Accept       part struct
+// @Produce      map[]
+func (r *Repository) CreatePart(ctx context.Context, part Part) (string, error) {
+	part.normalizeCurrencies()
+	if err := part.validateCosts(); err != nil {
+		return "", err
+	}
+	if err := part.Shipment.normalize(); err != nil {
+		return "", err
+	}
+	if err := part.normalizeGTIN(); err != nil {
 		return "", err
 	}
 
-	partID, err := result.LastInsertId()
+	values, err := partValues(part)
 	if err != nil {
 		return "", err
 	}
 
-	// Insert the initial version into the part_versions table
-	versionQuery := `
-		INSERT INTO part_versions (part_id, version, timestamp, name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-	_, err = r.db.Exec(versionQuery, partID, 1, time.Now(), part.Name, images, part.SKU, part.Description, part.Price, attributes, fitmentData, part.Location, shipment, metadata)
+	var partID int64
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		// Check if part with same details exists
+		existingPart, err := findPartByDetails(ctx, tx, part)
+		if err == nil && existingPart.ID != "" {
+			if err := deletePart(ctx, tx, existingPart.ID, part); err != nil {
+				return err
+			}
+		}
+
+		// Insert part into the parts table
+		query := `INSERT INTO parts (` + partDataColumns + `) VALUES (` + placeholders(len(values)) + `)`
+		result, err := tx.ExecContext(ctx, query, values...)
+		if err != nil {
+			return err
+		}
+
+		partID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		// Insert the initial version into the part_versions table
+		versionQuery := `INSERT INTO part_versions (part_id, version, timestamp, author, change_comment, request_id, ` + partDataColumns + `) VALUES (` + placeholders(len(values)+6) + `)`
+		_, err = tx.ExecContext(ctx, versionQuery, append([]interface{}{partID, 1, time.Now(), part.Author, part.ChangeComment, part.RequestID}, values...)...)
+		if err != nil {
+			return err
+		}
+
+		return appendPartEvent(ctx, tx, EventPartCreated, fmt.Sprintf("%d", partID), part, 0)
+	})
 	if err != nil {
 		return "", err
 	}
@@ -122,35 +287,16 @@ func (r *Repository) CreatePart(part Part) (string, error) {
 	return fmt.Sprintf("%d", partID), nil
 }
 
-func (r *Repository) findPartByDetails(part Part) (Part, error) {
-	query := `SELECT id, name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata FROM parts WHERE name = ? AND sku = ? AND price = ?`
-	row := r.db.QueryRow(query, part.Name, part.SKU, part.Price)
-
-	var existingPart Part
-	var images, attributes, fitmentData, shipment, metadata []byte
-	if err := row.Scan(&existingPart.ID, &existingPart.Name, &images, &existingPart.SKU, &existingPart.Description, &existingPart.Price, &attributes, &fitmentData, &existingPart.Location, &shipment, &metadata); err != nil {
+func findPartByDetails(ctx context.Context, q sqlExecutor, part Part) (Part, error) {
+	query := `SELECT ` + partColumns + ` FROM parts WHERE name = ? AND sku = ? AND price = ? AND currency = ?`
+	existingPart, err := scanPart(q.QueryRowContext(ctx, query, part.Name, part.SKU, part.Price, part.Price.Currency).Scan)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return Part{}, nil // Part not found
 		}
 		return Part{}, err
 	}
 
-	if err := json.Unmarshal(images, &existingPart.Images); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(attributes, &existingPart.Attributes); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(fitmentData, &existingPart.FitmentData); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(shipment, &existingPart.Shipment); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(metadata, &existingPart.Metadata); err != nil {
-		return Part{}, err
-	}
-
 	return existingPart, nil
 }
 
@@ -160,120 +306,136 @@ func (r *Repository) findPartByDetails(part Part) (Part, error) {
 // @Tags         parts/{id}
 // @Accept       id
 // @Produce      part
-func (r *Repository) GetPart(id string) (Part, error) {
-	query := `SELECT id, name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata FROM parts WHERE id = ?`
-	row := r.db.QueryRow(query, id)
+func (r *Repository) GetPart(ctx context.Context, id string) (Part, error) {
+	return getPart(ctx, r.db, id)
+}
 
-	var part Part
-	var images, attributes, fitmentData, shipment, metadata []byte
-	if err := row.Scan(&part.ID, &part.Name, &images, &part.SKU, &part.Description, &part.Price, &attributes, &fitmentData, &part.Location, &shipment, &metadata); err != nil {
+func getPart(ctx context.Context, q sqlExecutor, id string) (Part, error) {
+	query := `SELECT ` + partColumns + `, ` + latestVersionColumn + ` FROM parts WHERE id = ?`
+	part, err := scanPartWithVersion(q.QueryRowContext(ctx, query, id).Scan)
+	if err != nil {
 		if err == sql.ErrNoRows {
-			return Part{}, fmt.Errorf("part not found")
+			return Part{}, fmt.Errorf("part %w", errNotFound)
 		}
 		return Part{}, err
 	}
 
-	if err := json.Unmarshal(images, &part.Images); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(attributes, &part.Attributes); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(fitmentData, &part.FitmentData); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(shipment, &part.Shipment); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(metadata, &part.Metadata); err != nil {
-		return Part{}, err
-	}
-
 	return part, nil
 }
 
 // update part in db
-func (r *Repository) UpdatePart(id string, part Part) error {
-	// Marshal JSON fields
-	images, err := json.Marshal(part.Images)
-	if err != nil {
+func (r *Repository) UpdatePart(ctx context.Context, id string, part Part) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return updatePart(ctx, tx, id, part, EventPartUpdated, 0)
+	})
+}
+
+// updatePart saves a new version of a part and queues the event for it.
+func updatePart(ctx context.Context, tx *sql.Tx, id string, part Part, eventType string, restoredFrom int) error {
+	part.normalizeCurrencies()
+	if err := part.validateCosts(); err != nil {
 		return err
 	}
-	attributes, err := json.Marshal(part.Attributes)
-	if err != nil {
+	if err := part.Shipment.normalize(); err != nil {
 		return err
 	}
-	fitmentData, err := json.Marshal(part.FitmentData)
-	if err != nil {
+	if err := part.normalizeGTIN(); err != nil {
 		return err
 	}
-	shipment, err := json.Marshal(part.Shipment)
+
+	values, err := partValues(part)
 	if err != nil {
 		return err
 	}
-	metadata, err := json.Marshal(part.Metadata)
-	if err != nil {
+
+	// Lock the part so that concurrent updates take turns numbering versions
+	var locked int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM parts WHERE id = ? FOR UPDATE`, id).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("part %w", errNotFound)
+	} else if err != nil {
 		return err
 	}
 
-	// Get the current version number
+	// Get the next version number
 	var currentVersion int
-	query := `SELECT COUNT(*) FROM part_versions WHERE part_id = ?`
-	err = r.db.QueryRow(query, id).Scan(&currentVersion)
+	query := `SELECT COALESCE(MAX(version), 0) + 1 FROM part_versions WHERE part_id = ?`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&currentVersion)
 	if err != nil {
 		return err
 	}
-	currentVersion++
 
 	// Insert a new version in the part_versions table
-	versionQuery := `
-		INSERT INTO part_versions (part_id, version, timestamp, name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-	_, err = r.db.Exec(versionQuery, id, currentVersion, time.Now(), part.Name, images, part.SKU, part.Description, part.Price, attributes, fitmentData, part.Location, shipment, metadata)
+	versionQuery := `INSERT INTO part_versions (part_id, version, timestamp, author, change_comment, request_id, ` + partDataColumns + `) VALUES (` + placeholders(len(values)+6) + `)`
+	_, err = tx.ExecContext(ctx, versionQuery, append([]interface{}{id, currentVersion, time.Now(), part.Author, part.ChangeComment, part.RequestID}, values...)...)
 	if err != nil {
 		return err
 	}
 
 	// Update the existing part in the parts table
-	updateQuery := `
-		UPDATE parts SET name = ?, images = ?, sku = ?, description = ?, price = ?, attributes = ?, fitment_data = ?, location = ?, shipment = ?, metadata = ?
-		WHERE id = ?
-	`
-	_, err = r.db.Exec(updateQuery, part.Name, images, part.SKU, part.Description, part.Price, attributes, fitmentData, part.Location, shipment, metadata, id)
+	updateQuery := `UPDATE parts SET ` + strings.ReplaceAll(partDataColumns, ",", " = ?,") + ` = ? WHERE id = ?`
+	_, err = tx.ExecContext(ctx, updateQuery, append(values, id)...)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return appendPartEvent(ctx, tx, eventType, id, part, restoredFrom)
 }
 
 // DeletePart Deletes Part from db
 // @Summary      Delete Part
-// @Description  Delete part from db
+// @Description  Delete part from db; change carries the author and request ID of the deletion event
 // @Tags         parts/{id}
-// @Accept       id
+// @Accept       id, change
 // @Produce      part
-func (r *Repository) DeletePart(id string) error {
+func (r *Repository) DeletePart(ctx context.Context, id string, change Part) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return deletePart(ctx, tx, id, change)
+	})
+}
+
+func deletePart(ctx context.Context, tx *sql.Tx, id string, change Part) error {
+	// The deletion event carries the location, so that location streams see it
+	err := tx.QueryRowContext(ctx, `SELECT location FROM parts WHERE id = ? FOR UPDATE`, id).Scan(&change.Location)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("part %w", errNotFound)
+	} else if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"stock_alerts", "reorder_points", "part_stock", "price_list_overrides", "price_list_breaks", "part_identifiers"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE part_id = ?`, id); err != nil {
+			return err
+		}
+	}
+
 	query := `DELETE FROM parts WHERE id = ?`
-	_, err := r.db.Exec(query, id)
+	result, err := tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("part %w", errNotFound)
+	}
 
 	deleteQuery := `DELETE FROM part_versions WHERE part_id = ?`
-	_, err = r.db.Exec(deleteQuery, id)
+	_, err = tx.ExecContext(ctx, deleteQuery, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return appendPartEvent(ctx, tx, EventPartDeleted, id, change, 0)
 }
 
 // List Part Function
-func (r *Repository) ListParts() ([]Part, error) {
-	query := `SELECT id, name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata FROM parts`
-	rows, err := r.db.Query(query)
+func (r *Repository) ListParts(ctx context.Context, filter PartFilter) ([]Part, error) {
+	query := `SELECT ` + partColumns + ` FROM parts`
+	if where := filter.whereClause(); where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -281,25 +443,8 @@ func (r *Repository) ListParts() ([]Part, error) {
 
 	var parts []Part
 	for rows.Next() {
-		var part Part
-		var images, attributes, fitmentData, shipment, metadata []byte
-		if err := rows.Scan(&part.ID, &part.Name, &images, &part.SKU, &part.Description, &part.Price, &attributes, &fitmentData, &part.Location, &shipment, &metadata); err != nil {
-			return nil, err
-		}
-
-		if err := json.Unmarshal(images, &part.Images); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(attributes, &part.Attributes); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(fitmentData, &part.FitmentData); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(shipment, &part.Shipment); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(metadata, &part.Metadata); err != nil {
+		part, err := scanPart(rows.Scan)
+		if err != nil {
 			return nil, err
 		}
 
@@ -315,36 +460,54 @@ func (r *Repository) ListParts() ([]Part, error) {
 // @Tags         /parts/{id}/version/{version}
 // @Accept       id, version
 // @Produce      part
-func (r *Repository) GetPartVersion(id string, version int) (Part, error) {
-	query := `SELECT name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata FROM part_versions WHERE part_id = ? AND version = ?`
-	row := r.db.QueryRow(query, id, version)
+func (r *Repository) GetPartVersion(ctx context.Context, id string, version int) (Part, error) {
+	return getPartVersion(ctx, r.db, id, version)
+}
 
-	var part Part
-	var images, attributes, fitmentData, shipment, metadata []byte
-	if err := row.Scan(&part.Name, &images, &part.SKU, &part.Description, &part.Price, &attributes, &fitmentData, &part.Location, &shipment, &metadata); err != nil {
+func getPartVersion(ctx context.Context, q sqlExecutor, id string, version int) (Part, error) {
+	query := `SELECT ` + versionColumns + `, version, timestamp, author, COALESCE(change_comment, ''), request_id FROM part_versions WHERE part_id = ? AND version = ?`
+	var meta PartVersion
+	part, err := scanPart(func(dest ...interface{}) error {
+		return q.QueryRowContext(ctx, query, id, version).Scan(append(dest, &meta.Version, &meta.Timestamp, &meta.Author, &meta.ChangeComment, &meta.RequestID)...)
+	})
+	if err != nil {
 		if err == sql.ErrNoRows {
-			return Part{}, fmt.Errorf("version not found")
+			return Part{}, fmt.Errorf("version %w", errNotFound)
 		}
 		return Part{}, err
 	}
 
-	if err := json.Unmarshal(images, &part.Images); err != nil {
-		return Part{}, err
-	}
-	if err := json.Unmarshal(attributes, &part.Attributes); err != nil {
-		return Part{}, err
+	part.Version, part.Timestamp = meta.Version, meta.Timestamp
+	part.Author, part.ChangeComment, part.RequestID = meta.Author, meta.ChangeComment, meta.RequestID
+	return part, nil
+}
+
+// RestorePartVersion Restores an earlier version of a part
+// @Summary      Restore Part version
+// @Description  Save the data of an earlier version as a new version; costs are kept unless restoreCosts is set
+// @Tags         /parts/{id}/versions/{version}/restore
+// @Accept       id, version, author and comment, restore costs
+// @Produce      error
+func (r *Repository) RestorePartVersion(ctx context.Context, id string, version int, change Part, restoreCosts bool) error {
+	current, err := r.GetPart(ctx, id)
+	if err != nil {
+		return err
 	}
-	if err := json.Unmarshal(fitmentData, &part.FitmentData); err != nil {
-		return Part{}, err
+	restored, err := r.GetPartVersion(ctx, id, version)
+	if err != nil {
+		return err
 	}
-	if err := json.Unmarshal(shipment, &part.Shipment); err != nil {
-		return Part{}, err
+
+	if !restoreCosts {
+		restored.Cost, restored.LandedCosts = current.Cost, current.LandedCosts
 	}
-	if err := json.Unmarshal(metadata, &part.Metadata); err != nil {
-		return Part{}, err
+	restored.Author, restored.RequestID, restored.ChangeComment = change.Author, change.RequestID, change.ChangeComment
+	if restored.ChangeComment == "" {
+		restored.ChangeComment = fmt.Sprintf("restored version %d", version)
 	}
-
-	return part, nil
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return updatePart(ctx, tx, id, restored, EventVersionRestored, version)
+	})
 }
 
 // ListPartVersion List Part version from db
@@ -353,9 +516,9 @@ func (r *Repository) GetPartVersion(id string, version int) (Part, error) {
 // @Tags         /parts/{id}/versions
 // @Accept       id, version
 // @Produce      part
-func (r *Repository) ListPartVersions(id string) ([]PartVersion, error) {
-	query := `SELECT version, timestamp FROM part_versions WHERE part_id = ? ORDER BY version`
-	rows, err := r.db.Query(query, id)
+func (r *Repository) ListPartVersions(ctx context.Context, id string) ([]PartVersion, error) {
+	query := `SELECT version, timestamp, author, COALESCE(change_comment, ''), request_id FROM part_versions WHERE part_id = ? ORDER BY version`
+	rows, err := r.db.QueryContext(ctx, query, id)
 	if err != nil {
 		return nil, err
 	}
@@ -364,7 +527,7 @@ func (r *Repository) ListPartVersions(id string) ([]PartVersion, error) {
 	var versions []PartVersion
 	for rows.Next() {
 		var version PartVersion
-		if err := rows.Scan(&version.Version, &version.Timestamp); err != nil {
+		if err := rows.Scan(&version.Version, &version.Timestamp, &version.Author, &version.ChangeComment, &version.RequestID); err != nil {
 			return nil, err
 		}
 		versions = append(versions, version)
@@ -372,9 +535,13 @@ func (r *Repository) ListPartVersions(id string) ([]PartVersion, error) {
 	return versions, nil
 }
 
-func (r *Repository) SearchParts(query string) ([]Part, error) {
+func (r *Repository) SearchParts(ctx context.Context, query string, filter PartFilter) ([]Part, error) {
 	query = "%" + query + "%"
-	rows, err := r.db.Query(`SELECT id, name, images, sku, description, price, attributes, fitment_data, location, shipment, metadata FROM parts WHERE name LIKE ? OR description LIKE ?`, query, query)
+	sqlQuery := `SELECT ` + partColumns + ` FROM parts WHERE (name LIKE ? OR description LIKE ?)`
+	if where := filter.whereClause(); where != "" {
+		sqlQuery += " AND " + where
+	}
+	rows, err := r.db.QueryContext(ctx, sqlQuery, query, query)
 	if err != nil {
 		return nil, err
 	}
@@ -382,25 +549,8 @@ func (r *Repository) SearchParts(query string) ([]Part, error) {
 
 	var parts []Part
 	for rows.Next() {
-		var part Part
-		var images, attributes, fitmentData, shipment, metadata []byte
-		if err := rows.Scan(&part.ID, &part.Name, &images, &part.SKU, &part.Description, &part.Price, &attributes, &fitmentData, &part.Location, &shipment, &metadata); err != nil {
-			return nil, err
-		}
-
-		if err := json.Unmarshal(images, &part.Images); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(attributes, &part.Attributes); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(fitmentData, &part.FitmentData); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(shipment, &part.Shipment); err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(metadata, &part.Metadata); err != nil {
+		part, err := scanPart(rows.Scan)
+		if err != nil {
 			return nil, err
 		}
 
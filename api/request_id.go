@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+)
+
+// requestIDPattern limits the request IDs accepted from clients to ones that
+// are safe to store and log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware gives every request an ID, taken from the client's
+// X-Request-ID header when it sends a usable one, and echoes it in the
+// response.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			var err error
+			if id, err = randomHex(16); err != nil {
+				internalError(w, r, err)
+				return
+			}
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), id)))
+	})
+}
+
+// withRequestID returns a context that logs with a request ID, for work
+// done later on behalf of the request, such as publishing its events.
+func withRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
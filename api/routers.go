@@ -2,10 +2,20 @@ package main
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func NewRouter(repository *Repository) *mux.Router {
+func NewRouter(repository *Repository, notifier Notifier, rates []CarrierRateTable, boxes []Box, labels *LabelTemplates, auth *Authenticator, outbox *OutboxDispatcher, broker *Broker, metrics *prometheus.Registry) *mux.Router {
 	router := mux.NewRouter()
+	router.Use(MetricsMiddleware)
+	router.Use(RequestIDMiddleware)
+	router.Use(AccessLogMiddleware)
+	if auth != nil {
+		router.Use(auth.Middleware)
+	} else {
+		router.Use(AnonymousMiddleware)
+	}
+	router.Use(AuditMiddleware(repository))
 
 	router.HandleFunc("/parts", CreatePartHandler(repository)).Methods("POST")
 	router.HandleFunc("/parts/{id}", GetPartHandler(repository)).Methods("GET")
@@ -14,7 +24,70 @@ func NewRouter(repository *Repository) *mux.Router {
 	router.HandleFunc("/parts/{id}", DeletePartHandler(repository)).Methods("DELETE")
 	router.HandleFunc("/parts/{id}/version/{version}", GetPartVersionHandler(repository)).Methods("GET")
 	router.HandleFunc("/parts/{id}/versions", ListPartVersionsHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/versions/{version}/restore", RestorePartVersionHandler(repository)).Methods("POST")
+	router.HandleFunc("/parts/{id}/price", QuotePriceHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/price-history", GetPriceHistoryHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/barcode", PartBarcodeHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/label", PartLabelHandler(repository, labels)).Methods("GET")
+	router.HandleFunc("/parts/{id}/identifiers", ListPartIdentifiersHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/identifiers", AddPartIdentifierHandler(repository)).Methods("POST")
+	router.HandleFunc("/parts/{id}/identifiers/{identifierId}", DeletePartIdentifierHandler(repository)).Methods("DELETE")
+	router.HandleFunc("/parts/{id}/stock", GetPartStockHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/stock/{location}", SetStockLevelHandler(repository)).Methods("PUT")
+	router.HandleFunc("/parts/{id}/movements", RecordMovementHandler(repository)).Methods("POST")
+	router.HandleFunc("/parts/{id}/ledger", ListPartLedgerHandler(repository)).Methods("GET")
+	router.HandleFunc("/locations/{location}/ledger", ListLocationLedgerHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/reorder", ListReorderPointsHandler(repository)).Methods("GET")
+	router.HandleFunc("/parts/{id}/reorder/{location}", SetReorderPointHandler(repository)).Methods("PUT")
+	router.HandleFunc("/parts/{id}/reorder/{location}", DeleteReorderPointHandler(repository)).Methods("DELETE")
+	router.HandleFunc("/alerts", ListAlertsHandler(repository)).Methods("GET")
+	router.HandleFunc("/alerts/evaluate", EvaluateAlertsHandler(repository, notifier)).Methods("POST")
+	router.HandleFunc("/alerts/{id}/acknowledge", AcknowledgeAlertHandler(repository)).Methods("POST")
+	router.HandleFunc("/exchange-rates", ListExchangeRatesHandler(repository)).Methods("GET")
+	router.HandleFunc("/exchange-rates/{currency}", SetExchangeRateHandler(repository)).Methods("PUT")
+	router.HandleFunc("/price-lists", ListPriceListsHandler(repository)).Methods("GET")
+	router.HandleFunc("/price-lists", CreatePriceListHandler(repository)).Methods("POST")
+	router.HandleFunc("/price-lists/{name}", GetPriceListHandler(repository)).Methods("GET")
+	router.HandleFunc("/price-lists/{name}", UpdatePriceListHandler(repository)).Methods("PUT")
+	router.HandleFunc("/price-lists/{name}", DeletePriceListHandler(repository)).Methods("DELETE")
+	router.HandleFunc("/price-lists/{name}/parts/{id}", SetPriceOverrideHandler(repository)).Methods("PUT")
+	router.HandleFunc("/price-lists/{name}/parts/{id}", DeletePriceOverrideHandler(repository)).Methods("DELETE")
+	router.HandleFunc("/price-lists/{name}/breaks", AddQuantityBreakHandler(repository)).Methods("POST")
+	router.HandleFunc("/price-lists/{name}/breaks/{breakId}", DeleteQuantityBreakHandler(repository)).Methods("DELETE")
+	router.HandleFunc("/reports/margins", MarginReportHandler(repository)).Methods("GET")
+	router.HandleFunc("/reports/price-changes", PriceChangeReportHandler(repository)).Methods("GET")
+	router.HandleFunc("/shipping/quote", ShippingQuoteHandler(repository, rates)).Methods("POST")
+	router.HandleFunc("/shipping/cartonize", CartonizeHandler(repository, boxes)).Methods("POST")
+	router.HandleFunc("/shipping/compatibility", ShippingCompatibilityHandler(repository)).Methods("POST")
+	router.HandleFunc("/scan/{code}", ScanHandler(repository)).Methods("GET")
+	router.HandleFunc("/scans/unknown", ListUnknownScansHandler(repository)).Methods("GET")
 	router.HandleFunc("/search", SearchPartsHandler(repository)).Methods("GET")
+	router.HandleFunc("/keys", ListAPIKeysHandler(repository)).Methods("GET")
+	router.HandleFunc("/keys", IssueAPIKeyHandler(repository)).Methods("POST")
+	router.HandleFunc("/keys/{id}/rotate", RotateAPIKeyHandler(repository)).Methods("POST")
+	router.HandleFunc("/keys/{id}", RevokeAPIKeyHandler(repository)).Methods("DELETE")
+	router.HandleFunc("/auth/token", IssueTokenHandler(auth)).Methods("POST")
+	router.HandleFunc("/auth/login", LoginHandler(auth)).Methods("GET")
+	router.HandleFunc("/auth/callback", CallbackHandler(auth, repository)).Methods("GET")
+	router.HandleFunc("/auth/logout", LogoutHandler(repository)).Methods("POST")
+	router.HandleFunc("/auth/me", MeHandler()).Methods("GET")
+	router.HandleFunc("/webhooks", ListWebhooksHandler(repository)).Methods("GET")
+	router.HandleFunc("/webhooks", CreateWebhookHandler(repository)).Methods("POST")
+	router.HandleFunc("/webhooks/deliveries", ListWebhookDeliveriesHandler(repository)).Methods("GET")
+	router.HandleFunc("/webhooks/deliveries/{deliveryId}", GetWebhookDeliveryHandler(repository)).Methods("GET")
+	router.HandleFunc("/webhooks/deliveries/{deliveryId}/retry", RetryWebhookDeliveryHandler(repository)).Methods("POST")
+	router.HandleFunc("/webhooks/{id}", GetWebhookHandler(repository)).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", UpdateWebhookHandler(repository)).Methods("PUT")
+	router.HandleFunc("/webhooks/{id}", DeleteWebhookHandler(repository)).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/deliveries", ListWebhookDeliveriesHandler(repository)).Methods("GET")
+	router.HandleFunc("/outbox", OutboxStatusHandler(outbox)).Methods("GET")
+	router.HandleFunc("/events", EventStreamHandler(repository, broker)).Methods("GET")
+	router.HandleFunc("/events/ws", EventWebSocketHandler(repository, broker)).Methods("GET")
+	router.HandleFunc("/sync", SyncHandler(repository)).Methods("GET")
+	router.Handle("/metrics", MetricsHandler(metrics)).Methods("GET")
+	router.HandleFunc("/audit", ListAuditHandler(repository)).Methods("GET")
+	router.HandleFunc("/audit/verify", VerifyAuditHandler(repository)).Methods("GET")
+	router.HandleFunc("/audit/export", ExportAuditHandler(repository)).Methods("GET")
 
 	return router
 }
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PartIdentifier is an alternate code a part is known by, such as an OEM or
+// supplier part number.
+type PartIdentifier struct {
+	ID     int64  `json:"id"`
+	PartID string `json:"part_id"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+}
+
+type ScanResult struct {
+	Code      string      `json:"code"`
+	MatchedBy string      `json:"matched_by"`
+	Part      Part        `json:"part"`
+	Stock     *StockLevel `json:"stock,omitempty"`
+	AllStock  PartStock   `json:"all_stock"`
+}
+
+type UnknownScan struct {
+	ID        int64  `json:"id"`
+	Code      string `json:"code"`
+	Location  string `json:"location"`
+	Reason    string `json:"reason"`
+	ScannedAt string `json:"scanned_at"`
+}
+
+var identifierTypePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// gs1Symbologies are the AIM symbology identifiers of barcodes carrying GS1
+// element strings.
+var gs1Symbologies = map[string]bool{"]C1": true, "]e0": true, "]d2": true, "]Q3": true}
+
+// normalizeScanCode strips the AIM symbology identifier some scanners send
+// and extracts the GTIN from a GS1 element string starting with AI (01).
+func normalizeScanCode(code string) string {
+	code = strings.TrimSpace(code)
+	gs1 := false
+	if len(code) > 3 && code[0] == ']' {
+		gs1 = gs1Symbologies[code[:3]]
+		code = code[3:]
+	}
+	switch {
+	case strings.HasPrefix(code, "(01)") && len(code) >= 18:
+		return code[4:18]
+	case gs1 && strings.HasPrefix(code, "01") && len(code) >= 16:
+		return code[2:16]
+	}
+	return code
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// gtinVariants returns the forms a GTIN may be stored in: the GTIN-14 and
+// the GTIN-8, UPC-A and EAN-13 left after removing leading zeros.
+func gtinVariants(gtin string) []interface{} {
+	gtin14 := strings.Repeat("0", 14-len(gtin)) + gtin
+	variants := []interface{}{gtin14}
+	for _, n := range []int{13, 12, 8} {
+		if strings.Trim(gtin14[:14-n], "0") == "" {
+			variants = append(variants, gtin14[14-n:])
+		}
+	}
+	return variants
+}
+
+// ResolveScan Resolves a scanned code to a part
+// @Summary      Resolve scan
+// @Description  Find the part for a code by SKU, GTIN/UPC/EAN or alternate identifier, with its stock; unknown codes are logged
+// @Tags         /scan/{code}
+// @Accept       code, location
+// @Produce      scan result
+func (r *Repository) ResolveScan(ctx context.Context, code, location string) (ScanResult, error) {
+	code = normalizeScanCode(code)
+	result := ScanResult{Code: code}
+
+	part, err := scanPart(r.db.QueryRowContext(ctx, `SELECT `+partColumns+` FROM parts WHERE sku = ? ORDER BY id LIMIT 1`, code).Scan)
+	if err == nil {
+		result.MatchedBy = "sku"
+	} else if err != sql.ErrNoRows {
+		return ScanResult{}, err
+	}
+
+	reason := "no part has this SKU, GTIN or identifier"
+	if result.MatchedBy == "" && isDigits(code) {
+		if gtin, gtinErr := normalizeGTIN(code); gtinErr != nil {
+			reason = gtinErr.Error()
+		} else {
+			variants := gtinVariants(gtin)
+			query := `SELECT ` + partColumns + ` FROM parts WHERE gtin IN (` + placeholders(len(variants)) + `) ORDER BY id LIMIT 1`
+			part, err = scanPart(r.db.QueryRowContext(ctx, query, variants...).Scan)
+			if err == nil {
+				result.MatchedBy = "gtin"
+			} else if err != sql.ErrNoRows {
+				return ScanResult{}, err
+			}
+		}
+	}
+
+	if result.MatchedBy == "" {
+		var partID, identifierType string
+		err := r.db.QueryRowContext(ctx, `SELECT part_id, type FROM part_identifiers WHERE value = ? ORDER BY id LIMIT 1`, code).Scan(&partID, &identifierType)
+		switch {
+		case err == nil:
+			if part, err = r.GetPart(ctx, partID); err != nil {
+				return ScanResult{}, err
+			}
+			result.MatchedBy = "identifier:" + identifierType
+		case err != sql.ErrNoRows:
+			return ScanResult{}, err
+		}
+	}
+
+	if result.MatchedBy == "" {
+		if _, err := r.db.ExecContext(ctx, `INSERT INTO unknown_scans (code, location, reason) VALUES (?, ?, ?)`, code, location, reason); err != nil {
+			return ScanResult{}, err
+		}
+		return ScanResult{}, fmt.Errorf("code %q %w: %s", code, errNotFound, reason)
+	}
+
+	result.Part = part
+	if result.AllStock, err = r.GetPartStock(ctx, part.ID); err != nil {
+		return ScanResult{}, err
+	}
+	if location != "" {
+		result.Stock = &StockLevel{Location: location}
+		for _, level := range result.AllStock.Locations {
+			if level.Location == location {
+				result.Stock = &level
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// ListUnknownScans List codes that did not resolve to a part
+// @Summary      List unknown scans
+// @Description  List scanned codes that matched no part, newest first
+// @Tags         /scans/unknown
+// @Accept       limit
+// @Produce      unknown scans
+func (r *Repository) ListUnknownScans(ctx context.Context, limit int) ([]UnknownScan, error) {
+	query := `SELECT id, code, location, reason, scanned_at FROM unknown_scans ORDER BY id DESC`
+	var args []interface{}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scans := []UnknownScan{}
+	for rows.Next() {
+		var scan UnknownScan
+		if err := rows.Scan(&scan.ID, &scan.Code, &scan.Location, &scan.Reason, &scan.ScannedAt); err != nil {
+			return nil, err
+		}
+		scans = append(scans, scan)
+	}
+	return scans, rows.Err()
+}
+
+// ListPartIdentifiers List the alternate identifiers of a part
+// @Summary      List part identifiers
+// @Description  List the alternate identifiers of a part
+// @Tags         /parts/{id}/identifiers
+// @Accept       id
+// @Produce      identifiers
+func (r *Repository) ListPartIdentifiers(ctx context.Context, id string) ([]PartIdentifier, error) {
+	if _, err := r.GetPart(ctx, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, part_id, type, value FROM part_identifiers WHERE part_id = ? ORDER BY type, value`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identifiers := []PartIdentifier{}
+	for rows.Next() {
+		var identifier PartIdentifier
+		if err := rows.Scan(&identifier.ID, &identifier.PartID, &identifier.Type, &identifier.Value); err != nil {
+			return nil, err
+		}
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers, rows.Err()
+}
+
+// AddPartIdentifier Adds an alternate identifier to a part
+// @Summary      Add part identifier
+// @Description  Add an alternate identifier; a type and value may only belong to one part
+// @Tags         /parts/{id}/identifiers
+// @Accept       id, identifier
+// @Produce      identifier
+func (r *Repository) AddPartIdentifier(ctx context.Context, id string, identifier PartIdentifier) (PartIdentifier, error) {
+	identifier.Type = strings.ToLower(strings.TrimSpace(identifier.Type))
+	identifier.Value = normalizeScanCode(identifier.Value)
+	if !identifierTypePattern.MatchString(identifier.Type) {
+		return PartIdentifier{}, invalidf("invalid identifier type %q", identifier.Type)
+	}
+	if identifier.Value == "" {
+		return PartIdentifier{}, invalidf("identifier value is required")
+	}
+	if _, err := r.GetPart(ctx, id); err != nil {
+		return PartIdentifier{}, err
+	}
+
+	var existing string
+	err := r.db.QueryRowContext(ctx, `SELECT part_id FROM part_identifiers WHERE type = ? AND value = ?`, identifier.Type, identifier.Value).Scan(&existing)
+	if err == nil {
+		return PartIdentifier{}, invalidf("%s %s already identifies part %s", identifier.Type, identifier.Value, existing)
+	} else if err != sql.ErrNoRows {
+		return PartIdentifier{}, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `INSERT INTO part_identifiers (part_id, type, value) VALUES (?, ?, ?)`, id, identifier.Type, identifier.Value)
+	if err != nil {
+		return PartIdentifier{}, err
+	}
+	identifier.ID, err = result.LastInsertId()
+	identifier.PartID = id
+	return identifier, err
+}
+
+// DeletePartIdentifier Removes an alternate identifier from a part
+// @Summary      Delete part identifier
+// @Description  Remove an alternate identifier from a part
+// @Tags         /parts/{id}/identifiers/{identifierId}
+// @Accept       id, identifier id
+// @Produce      error
+func (r *Repository) DeletePartIdentifier(ctx context.Context, id string, identifierID int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM part_identifiers WHERE id = ? AND part_id = ?`, identifierID, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("identifier %w", errNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Scan lookup Handler
+func ScanHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := repository.ResolveScan(r.Context(), mux.Vars(r)["code"], r.URL.Query().Get("location"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		parts := []Part{result.Part}
+		if err := presentParts(repository, r, parts); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		result.Part = parts[0]
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// List unknown scans Handler
+func ListUnknownScansHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", value), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		scans, err := repository.ListUnknownScans(r.Context(), limit)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scans)
+	}
+}
+
+// List Part identifiers Handler
+func ListPartIdentifiersHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identifiers, err := repository.ListPartIdentifiers(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(identifiers)
+	}
+}
+
+// Add Part identifier Handler
+func AddPartIdentifierHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var identifier PartIdentifier
+		if err := json.NewDecoder(r.Body).Decode(&identifier); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		identifier, err := repository.AddPartIdentifier(r.Context(), mux.Vars(r)["id"], identifier)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(identifier)
+	}
+}
+
+// Delete Part identifier Handler
+func DeletePartIdentifierHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		identifierID, err := strconv.ParseInt(vars["identifierId"], 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := repository.DeletePartIdentifier(r.Context(), vars["id"], identifierID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -6,13 +6,20 @@ CREATE TABLE parts (
     name VARCHAR(255) NOT NULL,
     images JSON,
     sku VARCHAR(255),
+    gtin VARCHAR(14) NOT NULL DEFAULT '',
     description TEXT,
     price DECIMAL(10, 2),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    cost DECIMAL(10, 2) NULL,
+    cost_currency CHAR(3) NULL,
+    landed_costs JSON,
     attributes JSON,
     fitment_data JSON,
     location VARCHAR(255),
     shipment JSON,
-    metadata JSON
+    metadata JSON,
+    INDEX idx_parts_sku (sku),
+    INDEX idx_parts_gtin (gtin)
 );
 
 CREATE TABLE part_versions (
@@ -20,11 +27,19 @@ CREATE TABLE part_versions (
     part_id INT,
     version INT,
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    author VARCHAR(255) NOT NULL DEFAULT 'anonymous',
+    change_comment TEXT,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
     name VARCHAR(255),
     images JSON,
     sku VARCHAR(255),
+    gtin VARCHAR(14) NOT NULL DEFAULT '',
     description TEXT,
     price DECIMAL(10, 2),
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    cost DECIMAL(10, 2) NULL,
+    cost_currency CHAR(3) NULL,
+    landed_costs JSON,
     attributes JSON,
     fitment_data JSON,
     location VARCHAR(255),
@@ -32,3 +47,209 @@ CREATE TABLE part_versions (
     metadata JSON,
     FOREIGN KEY (part_id) REFERENCES parts(id)
 );
+
+CREATE TABLE part_stock (
+    part_id INT NOT NULL,
+    location VARCHAR(255) NOT NULL,
+    on_hand INT NOT NULL DEFAULT 0,
+    reserved INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (part_id, location),
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE TABLE inventory_ledger (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    movement_id CHAR(32) NOT NULL,
+    part_id INT NOT NULL,
+    location VARCHAR(255) NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    quantity INT NOT NULL,
+    on_hand_after INT NOT NULL,
+    reason_code VARCHAR(64) NOT NULL DEFAULT '',
+    work_order VARCHAR(255) NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_inventory_ledger_part (part_id, id),
+    INDEX idx_inventory_ledger_location (location, id)
+);
+
+CREATE TABLE reorder_points (
+    part_id INT NOT NULL,
+    location VARCHAR(255) NOT NULL,
+    reorder_point INT NOT NULL,
+    max_quantity INT NOT NULL,
+    PRIMARY KEY (part_id, location),
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE TABLE stock_alerts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    part_id INT NOT NULL,
+    location VARCHAR(255) NOT NULL,
+    available INT NOT NULL,
+    reorder_point INT NOT NULL,
+    suggested_quantity INT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_at TIMESTAMP NULL,
+    acknowledged_by VARCHAR(255) NOT NULL DEFAULT '',
+    notified_at TIMESTAMP NULL,
+    INDEX idx_stock_alerts_part (part_id, location, status),
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE TABLE exchange_rates (
+    currency CHAR(3) PRIMARY KEY,
+    rate DECIMAL(18, 8) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE price_lists (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    description TEXT,
+    rule VARCHAR(16) NOT NULL,
+    percent DECIMAL(9, 4) NOT NULL DEFAULT 0
+);
+
+CREATE TABLE price_list_overrides (
+    price_list_id INT NOT NULL,
+    part_id INT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    PRIMARY KEY (price_list_id, part_id),
+    FOREIGN KEY (price_list_id) REFERENCES price_lists(id),
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE TABLE price_list_breaks (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    price_list_id INT NOT NULL,
+    part_id INT NULL,
+    min_quantity INT NOT NULL,
+    percent_off DECIMAL(7, 4) NOT NULL,
+    FOREIGN KEY (price_list_id) REFERENCES price_lists(id),
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE TABLE part_identifiers (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    part_id INT NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    UNIQUE KEY uq_part_identifiers (type, value),
+    INDEX idx_part_identifiers_value (value),
+    FOREIGN KEY (part_id) REFERENCES parts(id)
+);
+
+CREATE TABLE unknown_scans (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(255) NOT NULL,
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    scanned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE api_keys (
+    id CHAR(16) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    rotated_from CHAR(16) NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    revoked_at DATETIME NULL
+);
+
+CREATE TABLE sessions (
+    id_hash CHAR(64) PRIMARY KEY,
+    subject VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    roles JSON,
+    csrf_token CHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    INDEX idx_sessions_expires (expires_at)
+);
+
+CREATE TABLE audit_log (
+    seq BIGINT PRIMARY KEY,
+    occurred_at CHAR(27) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    action VARCHAR(255) NOT NULL,
+    entity VARCHAR(64) NOT NULL DEFAULT '',
+    entity_id VARCHAR(255) NOT NULL DEFAULT '',
+    details LONGTEXT NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL,
+    INDEX idx_audit_entity (entity, entity_id)
+);
+
+-- The audit log is append-only; the hash chain detects changes made around these triggers
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log FOR EACH ROW
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log FOR EACH ROW
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TABLE webhook_subscriptions (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    events JSON NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    secret VARCHAR(128) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    subscription_id BIGINT NOT NULL,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload LONGTEXT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NULL,
+    last_status_code INT NULL,
+    last_error TEXT NOT NULL DEFAULT (''),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at DATETIME NULL,
+    UNIQUE KEY uq_webhook_deliveries_event (subscription_id, event_id),
+    INDEX idx_webhook_deliveries_due (status, next_attempt_at),
+    INDEX idx_webhook_deliveries_subscription (subscription_id, id)
+);
+
+CREATE TABLE webhook_attempts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    delivery_id BIGINT NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT NULL,
+    error TEXT NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    attempted_at DATETIME NOT NULL,
+    INDEX idx_webhook_attempts_delivery (delivery_id, attempt)
+);
+
+CREATE TABLE outbox (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    part_id VARCHAR(64) NOT NULL,
+    payload LONGTEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    INDEX idx_outbox_created (created_at)
+);
+
+-- Writers lock this row from their outbox insert until they commit, so outbox IDs commit in order
+CREATE TABLE outbox_lock (
+    id TINYINT PRIMARY KEY
+);
+INSERT INTO outbox_lock (id) VALUES (1);
+
+CREATE TABLE outbox_cursors (
+    publisher VARCHAR(64) PRIMARY KEY,
+    last_seq BIGINT NOT NULL DEFAULT 0,
+    updated_at DATETIME NULL
+);
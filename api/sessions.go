@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// sessionCookie holds the session id of a user signed in through OIDC. Only
+// a hash of the id is stored.
+const sessionCookie = "pdm_session"
+
+// CreateSession Creates a login session
+// @Summary      Create session
+// @Description  Store a session for a signed-in user and return its id and CSRF token
+// @Tags         /auth/callback
+// @Accept       principal, ttl
+// @Produce      session id, csrf token
+func (r *Repository) CreateSession(ctx context.Context, principal *Principal, ttl time.Duration) (string, string, error) {
+	id, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	csrf, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	roles, err := json.Marshal(principal.Roles)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?`, now); err != nil {
+		return "", "", err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO sessions (id_hash, subject, name, roles, csrf_token, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		hashSecret(id), principal.Subject, principal.Name, roles, csrf, now, now.Add(ttl))
+	if err != nil {
+		return "", "", err
+	}
+	return id, csrf, nil
+}
+
+// authenticateSession returns the principal of an unexpired session, with
+// the CSRF token its mutating requests must send.
+func (r *Repository) authenticateSession(ctx context.Context, id string) (*Principal, error) {
+	principal := &Principal{Via: "session"}
+	var roles []byte
+	err := r.db.QueryRowContext(ctx, `SELECT subject, name, roles, csrf_token FROM sessions WHERE id_hash = ? AND expires_at > ?`, hashSecret(id), time.Now().UTC()).
+		Scan(&principal.Subject, &principal.Name, &roles, &principal.csrfToken)
+	if err == sql.ErrNoRows {
+		return nil, invalidf("session has expired")
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(roles, &principal.Roles); err != nil {
+		return nil, err
+	}
+	return principal, nil
+}
+
+// DeleteSession Ends a login session
+// @Summary      Delete session
+// @Description  Sign the user out by deleting the session
+// @Tags         /auth/logout
+// @Accept       session id
+// @Produce      error
+func (r *Repository) DeleteSession(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE id_hash = ?`, hashSecret(id))
+	return err
+}
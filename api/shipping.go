@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// CarrierRateTable is one carrier service's rates, loaded from the local
+// rate file. Rates are per package by zone and billable weight in pounds;
+// weights above the last bracket add AdditionalPerLb per extra pound.
+type CarrierRateTable struct {
+	Carrier            string                   `json:"carrier"`
+	Service            string                   `json:"service"`
+	Currency           string                   `json:"currency"`
+	DimDivisor         float64                  `json:"dim_divisor"`
+	Zones              map[string][]RateBracket `json:"zones"`
+	AdditionalPerLb    string                   `json:"additional_per_lb"`
+	HazardousSurcharge string                   `json:"hazardous_surcharge"`
+	FragileSurcharge   string                   `json:"fragile_surcharge"`
+}
+
+type RateBracket struct {
+	MaxWeight float64 `json:"max_weight"`
+	Rate      string  `json:"rate"`
+}
+
+type QuoteItem struct {
+	PartID   string `json:"part_id"`
+	Quantity int    `json:"quantity"`
+}
+
+type ShippingQuoteRequest struct {
+	Zone    string      `json:"zone"`
+	Carrier string      `json:"carrier"`
+	Items   []QuoteItem `json:"items"`
+}
+
+// QuoteLine is the cost of shipping every unit of one part. Each unit is
+// rated as its own package.
+type QuoteLine struct {
+	PartID             string  `json:"part_id"`
+	Quantity           int     `json:"quantity"`
+	ActualWeight       float64 `json:"actual_weight_lb"`
+	DimensionalWeight  float64 `json:"dimensional_weight_lb"`
+	BillableWeight     float64 `json:"billable_weight_lb"`
+	BaseRate           Money   `json:"base_rate"`
+	HazardousSurcharge Money   `json:"hazardous_surcharge"`
+	FragileSurcharge   Money   `json:"fragile_surcharge"`
+	UnitTotal          Money   `json:"unit_total"`
+	LineTotal          Money   `json:"line_total"`
+}
+
+type ServiceQuote struct {
+	Carrier string      `json:"carrier"`
+	Service string      `json:"service"`
+	Lines   []QuoteLine `json:"lines"`
+	Total   Money       `json:"total"`
+}
+
+type ShippingQuote struct {
+	Zone   string         `json:"zone"`
+	Quotes []ServiceQuote `json:"quotes"`
+	Errors []string       `json:"errors,omitempty"`
+}
+
+// LoadCarrierRates reads carrier rate tables from a JSON file holding an
+// array of CarrierRateTable.
+func LoadCarrierRates(path string) ([]CarrierRateTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []CarrierRateTable
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	for i := range tables {
+		if err := tables[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s %s: %v", tables[i].Carrier, tables[i].Service, err)
+		}
+	}
+	return tables, nil
+}
+
+func (t *CarrierRateTable) validate() error {
+	if t.Carrier == "" || t.Service == "" {
+		return fmt.Errorf("carrier and service are required")
+	}
+	if t.Currency == "" {
+		t.Currency = BaseCurrency
+	}
+	if t.DimDivisor == 0 {
+		t.DimDivisor = dimDivisors[t.Carrier]
+	}
+	for _, amount := range []string{t.AdditionalPerLb, t.HazardousSurcharge, t.FragileSurcharge} {
+		if _, err := t.money(amount); err != nil {
+			return err
+		}
+	}
+	for zone, brackets := range t.Zones {
+		if len(brackets) == 0 {
+			return fmt.Errorf("zone %s has no rates", zone)
+		}
+		sort.Slice(brackets, func(i, j int) bool { return brackets[i].MaxWeight < brackets[j].MaxWeight })
+		for _, bracket := range brackets {
+			if _, err := t.money(bracket.Rate); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// money parses an amount in the table currency; empty means zero.
+func (t CarrierRateTable) money(amount string) (Money, error) {
+	if amount == "" {
+		return Money{Currency: t.Currency}, nil
+	}
+	return ParseMoney(amount, t.Currency)
+}
+
+// packageRate returns the base rate of one package of the given billable weight.
+func (t CarrierRateTable) packageRate(zone string, weight float64) (Money, error) {
+	brackets, ok := t.Zones[zone]
+	if !ok {
+		return Money{}, invalidf("%s %s does not serve zone %s", t.Carrier, t.Service, zone)
+	}
+	for _, bracket := range brackets {
+		if weight <= bracket.MaxWeight {
+			return t.money(bracket.Rate)
+		}
+	}
+
+	last := brackets[len(brackets)-1]
+	rate, _ := t.money(last.Rate)
+	perLb, _ := t.money(t.AdditionalPerLb)
+	if perLb.Cents == 0 {
+		return Money{}, invalidf("%s %s does not ship packages over %g lb", t.Carrier, t.Service, last.MaxWeight)
+	}
+	rate.Cents += int64(math.Ceil(weight-last.MaxWeight)) * perLb.Cents
+	return rate, nil
+}
+
+// quoteLine rates quantity units of a part, each as its own package.
+func (t CarrierRateTable) quoteLine(zone string, part Part, quantity int) (QuoteLine, error) {
+	line := QuoteLine{PartID: part.ID, Quantity: quantity, ActualWeight: part.Shipment.WeightLb()}
+	if d := part.Shipment.Dimensions; d != nil && t.DimDivisor > 0 {
+		line.DimensionalWeight = d.DimWeightLb(t.DimDivisor)
+	}
+	line.BillableWeight = math.Ceil(math.Max(line.ActualWeight, line.DimensionalWeight))
+	if line.BillableWeight < 1 {
+		line.BillableWeight = 1
+	}
+
+	var err error
+	if line.BaseRate, err = t.packageRate(zone, line.BillableWeight); err != nil {
+		return QuoteLine{}, err
+	}
+	line.HazardousSurcharge = Money{Currency: t.Currency}
+	if part.Shipment.Hazardous {
+		line.HazardousSurcharge, _ = t.money(t.HazardousSurcharge)
+	}
+	line.FragileSurcharge = Money{Currency: t.Currency}
+	if part.Shipment.Fragile {
+		line.FragileSurcharge, _ = t.money(t.FragileSurcharge)
+	}
+
+	unit := line.BaseRate.Cents + line.HazardousSurcharge.Cents + line.FragileSurcharge.Cents
+	line.UnitTotal = Money{Cents: unit, Currency: t.Currency}
+	line.LineTotal = Money{Cents: unit * int64(quantity), Currency: t.Currency}
+	return line, nil
+}
+
+// getItemParts loads the part of every item and checks the quantities.
+func (r *Repository) getItemParts(ctx context.Context, items []QuoteItem) ([]Part, error) {
+	parts := make([]Part, len(items))
+	for i, item := range items {
+		if item.Quantity < 1 {
+			return nil, invalidf("quantity of part %s must be at least 1", item.PartID)
+		}
+		part, err := r.GetPart(ctx, item.PartID)
+		if errors.Is(err, errNotFound) {
+			return nil, invalidf("part %s not found", item.PartID)
+		} else if err != nil {
+			return nil, err
+		}
+		parts[i] = part
+	}
+	return parts, nil
+}
+
+// QuoteShipping Quotes shipping for a list of parts
+// @Summary      Quote shipping
+// @Description  Rate parts against every loaded carrier service serving the zone
+// @Tags         /shipping/quote
+// @Accept       zone, items
+// @Produce      shipping quote
+func (r *Repository) QuoteShipping(ctx context.Context, tables []CarrierRateTable, request ShippingQuoteRequest) (ShippingQuote, error) {
+	if request.Zone == "" {
+		return ShippingQuote{}, invalidf("zone is required")
+	}
+	if len(request.Items) == 0 {
+		return ShippingQuote{}, invalidf("items are required")
+	}
+
+	parts, err := r.getItemParts(ctx, request.Items)
+	if err != nil {
+		return ShippingQuote{}, err
+	}
+
+	quote := ShippingQuote{Zone: request.Zone, Quotes: []ServiceQuote{}}
+	for _, table := range tables {
+		if request.Carrier != "" && table.Carrier != request.Carrier {
+			continue
+		}
+
+		service := ServiceQuote{Carrier: table.Carrier, Service: table.Service, Total: Money{Currency: table.Currency}}
+		var err error
+		for i, item := range request.Items {
+			var line QuoteLine
+			if line, err = table.quoteLine(request.Zone, parts[i], item.Quantity); err != nil {
+				break
+			}
+			service.Lines = append(service.Lines, line)
+			service.Total.Cents += line.LineTotal.Cents
+		}
+		if err != nil {
+			quote.Errors = append(quote.Errors, err.Error())
+			continue
+		}
+		quote.Quotes = append(quote.Quotes, service)
+	}
+
+	sort.SliceStable(quote.Quotes, func(i, j int) bool { return quote.Quotes[i].Total.Cents < quote.Quotes[j].Total.Cents })
+	return quote, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Shipping quote Handler
+func ShippingQuoteHandler(repository *Repository, rates []CarrierRateTable) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(rates) == 0 {
+			http.Error(w, "no carrier rate tables loaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		var request ShippingQuoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		quote, err := repository.QuoteShipping(r.Context(), rates, request)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(quote)
+	}
+}
+
+// Shipping compatibility Handler
+func ShippingCompatibilityHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			PartIDs []string `json:"part_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := repository.CheckShipmentCompatibility(r.Context(), request.PartIDs)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// Cartonize Handler
+func CartonizeHandler(repository *Repository, boxes []Box) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(boxes) == 0 {
+			http.Error(w, "no box catalog loaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		var request CartonizeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		plan, err := repository.Cartonize(r.Context(), boxes, request)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+type StockLevel struct {
+	Location  string `json:"location"`
+	OnHand    int    `json:"on_hand"`
+	Reserved  int    `json:"reserved"`
+	Available int    `json:"available"`
+}
+
+type PartStock struct {
+	PartID    string       `json:"part_id"`
+	OnHand    int          `json:"on_hand"`
+	Reserved  int          `json:"reserved"`
+	Available int          `json:"available"`
+	Locations []StockLevel `json:"locations"`
+}
+
+// PartFilter narrows the parts returned by ListParts and SearchParts.
+// A nil InStock means stock status is not considered.
+type PartFilter struct {
+	InStock *bool
+}
+
+// whereClause returns the SQL condition for the filter, or an empty string
+// when the filter is empty.
+func (f PartFilter) whereClause() string {
+	if f.InStock == nil {
+		return ""
+	}
+	inStock := `id IN (SELECT part_id FROM part_stock GROUP BY part_id HAVING SUM(on_hand - reserved) > 0)`
+	if *f.InStock {
+		return inStock
+	}
+	return "NOT " + inStock
+}
+
+// GetPartStock Get stock levels of a part from db
+// @Summary      Get Part stock
+// @Description  Get on-hand, reserved and available quantities per location
+// @Tags         /parts/{id}/stock
+// @Accept       id
+// @Produce      part stock
+func (r *Repository) GetPartStock(ctx context.Context, id string) (PartStock, error) {
+	var exists int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM parts WHERE id = ?`, id).Scan(&exists); err != nil {
+		return PartStock{}, err
+	}
+	if exists == 0 {
+		return PartStock{}, fmt.Errorf("part %w", errNotFound)
+	}
+
+	query := `SELECT location, on_hand, reserved FROM part_stock WHERE part_id = ? ORDER BY location`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return PartStock{}, err
+	}
+	defer rows.Close()
+
+	stock := PartStock{PartID: id, Locations: []StockLevel{}}
+	for rows.Next() {
+		var level StockLevel
+		if err := rows.Scan(&level.Location, &level.OnHand, &level.Reserved); err != nil {
+			return PartStock{}, err
+		}
+		level.Available = level.OnHand - level.Reserved
+
+		stock.OnHand += level.OnHand
+		stock.Reserved += level.Reserved
+		stock.Available += level.Available
+		stock.Locations = append(stock.Locations, level)
+	}
+	if err := rows.Err(); err != nil {
+		return PartStock{}, err
+	}
+
+	return stock, nil
+}
+
+// SetStockLevel Sets stock of a part at a location
+// @Summary      Set stock level
+// @Description  Record a count adjustment for the on-hand difference and set the reserved quantity
+// @Tags         /parts/{id}/stock/{location}
+// @Accept       id, location, stock level
+// @Produce      stock level
+func (r *Repository) SetStockLevel(ctx context.Context, id, location string, onHand, reserved int) (StockLevel, error) {
+	if location == "" {
+		return StockLevel{}, invalidf("location is required")
+	}
+	if onHand < 0 || reserved < 0 {
+		return StockLevel{}, invalidf("quantities must not be negative")
+	}
+	if reserved > onHand {
+		return StockLevel{}, invalidf("reserved quantity exceeds on-hand quantity")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return StockLevel{}, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM parts WHERE id = ?`, id).Scan(&exists); err != nil {
+		return StockLevel{}, err
+	}
+	if exists == 0 {
+		return StockLevel{}, fmt.Errorf("part %w", errNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT IGNORE INTO part_stock (part_id, location, on_hand, reserved) VALUES (?, ?, 0, 0)`, id, location)
+	if err != nil {
+		return StockLevel{}, err
+	}
+	var current int
+	query := `SELECT on_hand FROM part_stock WHERE part_id = ? AND location = ? FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, query, id, location).Scan(&current); err != nil {
+		return StockLevel{}, err
+	}
+
+	// On-hand only changes through the ledger, so a set is recorded as a count adjustment.
+	if delta := onHand - current; delta != 0 {
+		movementID, err := newMovementID()
+		if err != nil {
+			return StockLevel{}, err
+		}
+		entry := LedgerEntry{MovementID: movementID, PartID: id, Location: location, Type: MovementAdjust, Quantity: delta, ReasonCode: "count"}
+		if _, err := postLedgerEntry(ctx, tx, entry); err != nil {
+			return StockLevel{}, err
+		}
+	}
+
+	updateQuery := `UPDATE part_stock SET reserved = ? WHERE part_id = ? AND location = ?`
+	if _, err := tx.ExecContext(ctx, updateQuery, reserved, id, location); err != nil {
+		return StockLevel{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return StockLevel{}, err
+	}
+	return StockLevel{Location: location, OnHand: onHand, Reserved: reserved, Available: onHand - reserved}, nil
+}
+
+// parseInStock reads the optional in_stock query parameter into a PartFilter.
+func parseInStock(value string) (PartFilter, error) {
+	if value == "" {
+		return PartFilter{}, nil
+	}
+	inStock, err := strconv.ParseBool(value)
+	if err != nil {
+		return PartFilter{}, invalidf("invalid in_stock value %q", value)
+	}
+	return PartFilter{InStock: &inStock}, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// EventStreamReset tells a change stream client that the events after its
+	// cursor are no longer in the outbox, so it must reload what it shows.
+	// Its seq is the cursor to resume from.
+	EventStreamReset = "stream.reset"
+
+	streamBuffer    = 256
+	streamHeartbeat = 25 * time.Second
+)
+
+// StreamFilter selects the events a change stream sends. An empty set
+// accepts every value.
+type StreamFilter struct {
+	PartIDs   map[string]bool
+	Locations map[string]bool
+	Types     map[string]bool
+}
+
+// parseStreamFilter reads the part_id, location and type query parameters,
+// each a comma-separated list that may also be repeated.
+func parseStreamFilter(query url.Values) (StreamFilter, error) {
+	filter := StreamFilter{
+		PartIDs:   queryList(query["part_id"]),
+		Locations: queryList(query["location"]),
+		Types:     queryList(query["type"]),
+	}
+	for eventType := range filter.Types {
+		if !eventTypes[eventType] {
+			return StreamFilter{}, invalidf("unknown event type %q", eventType)
+		}
+	}
+	return filter, nil
+}
+
+func queryList(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				set[item] = true
+			}
+		}
+	}
+	return set
+}
+
+// Match reports whether the filter accepts an event.
+func (f StreamFilter) Match(event Event) bool {
+	return (len(f.PartIDs) == 0 || f.PartIDs[event.PartID]) &&
+		(len(f.Locations) == 0 || f.Locations[event.Location]) &&
+		(len(f.Types) == 0 || f.Types[event.Type])
+}
+
+// streamEvents sends the events after cursor that match the filter, first
+// from the outbox and then live from the broker, until ctx is done or send
+// or heartbeat fails. A subscription that the broker drops for falling
+// behind catches up from the outbox again. Each event is sent once, in
+// order, and its seq is the cursor a client resumes from.
+func streamEvents(ctx context.Context, repository *Repository, broker *Broker, filter StreamFilter, cursor int64, send func(Event) error, heartbeat func() error) error {
+	expired, err := repository.CursorExpired(ctx, cursor)
+	if err != nil {
+		return err
+	}
+	if expired {
+		if cursor, err = repository.OutboxHead(ctx); err != nil {
+			return err
+		}
+		reset := Event{Seq: cursor, Type: EventStreamReset, OccurredAt: time.Now().UTC().Format(time.RFC3339Nano)}
+		if err := send(reset); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		var dropped bool
+		cursor, dropped, err = streamOnce(ctx, repository, broker, filter, cursor, send, heartbeat, ticker.C)
+		if err != nil || !dropped {
+			return err
+		}
+	}
+}
+
+// streamOnce subscribes to the broker before reading the outbox, so that no
+// event falls between the two, and skips live events it has already sent.
+func streamOnce(ctx context.Context, repository *Repository, broker *Broker, filter StreamFilter, cursor int64, send func(Event) error, heartbeat func() error, ticks <-chan time.Time) (int64, bool, error) {
+	subscription := broker.Subscribe(filter.Match, streamBuffer)
+	defer subscription.Close()
+
+	for {
+		events, err := repository.ReadEvents(ctx, cursor, outboxBatchSize)
+		if err != nil {
+			return cursor, false, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			if filter.Match(event) {
+				if err := send(event); err != nil {
+					return cursor, false, err
+				}
+			}
+			cursor = event.Seq
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return cursor, false, nil
+		case <-ticks:
+			if err := heartbeat(); err != nil {
+				return cursor, false, err
+			}
+		case event, ok := <-subscription.C:
+			if !ok {
+				return cursor, true, nil
+			}
+			if event.Seq <= cursor {
+				continue
+			}
+			if err := send(event); err != nil {
+				return cursor, false, err
+			}
+			cursor = event.Seq
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// allowedOrigins are the browser origins that may call the API, set from
+// CORS_ALLOWED_ORIGINS. WebSocket handshakes are not covered by CORS, so the
+// change stream checks them itself.
+var allowedOrigins = []string{"http://localhost:3000"}
+
+const streamWriteTimeout = 10 * time.Second
+
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range allowedOrigins {
+			if allowed == "*" || strings.EqualFold(origin, allowed) {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// streamCursor returns the cursor a stream starts after: the Last-Event-ID
+// an EventSource sends when it reconnects, the cursor query parameter, or
+// the current outbox position for a new client.
+func streamCursor(r *http.Request, repository *Repository) (int64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("cursor")
+	}
+	if value == "" {
+		return repository.OutboxHead(r.Context())
+	}
+	cursor, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || cursor < 0 {
+		return 0, invalidf("invalid cursor %q", value)
+	}
+	return cursor, nil
+}
+
+// Server-Sent Events change stream Handler
+func EventStreamHandler(repository *Repository, broker *Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		filter, err := parseStreamFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor, err := streamCursor(r, repository)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 3000\n\n")
+		flusher.Flush()
+
+		send := func(event Event) error {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+		heartbeat := func() error {
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+
+		if err := streamEvents(r.Context(), repository, broker, filter, cursor, send, heartbeat); err != nil {
+			slog.InfoContext(r.Context(), "Event stream ended", "error", err)
+		}
+	}
+}
+
+// WebSocket change stream Handler
+func EventWebSocketHandler(repository *Repository, broker *Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseStreamFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor, err := streamCursor(r, repository)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		conn, err := streamUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // Upgrade has already responded
+		}
+		defer conn.Close()
+
+		// Clients only send control frames; reading them notices a closed connection
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		conn.SetReadLimit(4096)
+		conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		})
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		send := func(event Event) error {
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			return conn.WriteJSON(event)
+		}
+		heartbeat := func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+		}
+
+		err = streamEvents(ctx, repository, broker, filter, cursor, send, heartbeat)
+		if err != nil {
+			slog.InfoContext(r.Context(), "Event stream ended", "error", err)
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	syncDefaultLimit = 200
+	syncMaxLimit     = 1000
+)
+
+// errCursorExpired is returned for a sync cursor whose events have been
+// pruned from the outbox.
+var errCursorExpired = errors.New("cursor expired; sync again without since")
+
+// SyncChange is the state of a part that changed: the part as it is now,
+// without costs, or a tombstone when it has been deleted.
+type SyncChange struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted,omitempty"`
+	Part    *Part  `json:"part,omitempty"`
+}
+
+// SyncPage is one page of the sync feed. Cursor is passed back as since to
+// get the next page, or the next changes once HasMore is false.
+type SyncPage struct {
+	Changes []SyncChange `json:"changes"`
+	Cursor  string       `json:"cursor"`
+	HasMore bool         `json:"has_more"`
+}
+
+// syncCursor is an outbox position. During a first sync it also holds the
+// last part ID copied: "<seq>.<part id>" while parts are being copied, and
+// "<seq>~<part id>" while catching up on the changes made meanwhile.
+type syncCursor struct {
+	seq        int64
+	snapshot   bool
+	catchingUp bool
+	afterID    int64
+}
+
+func parseSyncCursor(value string) (syncCursor, error) {
+	var cursor syncCursor
+	seq, after, snapshot := strings.Cut(value, ".")
+	if !snapshot {
+		seq, after, cursor.catchingUp = strings.Cut(value, "~")
+	}
+	cursor.snapshot = snapshot
+	var err error
+	if cursor.seq, err = strconv.ParseInt(seq, 10, 64); err != nil || cursor.seq < 0 {
+		return syncCursor{}, invalidf("invalid cursor %q", value)
+	}
+	if cursor.snapshot || cursor.catchingUp {
+		if cursor.afterID, err = strconv.ParseInt(after, 10, 64); err != nil || cursor.afterID < 0 {
+			return syncCursor{}, invalidf("invalid cursor %q", value)
+		}
+	}
+	return cursor, nil
+}
+
+func (c syncCursor) String() string {
+	switch {
+	case c.snapshot:
+		return fmt.Sprintf("%d.%d", c.seq, c.afterID)
+	case c.catchingUp:
+		return fmt.Sprintf("%d~%d", c.seq, c.afterID)
+	}
+	return strconv.FormatInt(c.seq, 10)
+}
+
+// syncCollector keeps the latest state of each part in a page, in the order
+// the parts first changed. copiedThrough is the last part ID a first sync
+// copied, while it catches up.
+type syncCollector struct {
+	changes       []SyncChange
+	index         map[string]int
+	created       map[string]bool
+	copiedThrough int64
+}
+
+func (c *syncCollector) has(id string) bool {
+	_, ok := c.index[id]
+	return ok
+}
+
+func (c *syncCollector) put(change SyncChange) {
+	if i, ok := c.index[change.ID]; ok {
+		c.changes[i] = change
+		return
+	}
+	c.index[change.ID] = len(c.changes)
+	c.changes = append(c.changes, change)
+}
+
+// result drops parts both created and deleted within the page, which the
+// client has never seen. A part a first sync may have copied before it was
+// deleted keeps its tombstone.
+func (c *syncCollector) result() []SyncChange {
+	changes := []SyncChange{}
+	for _, change := range c.changes {
+		if !(change.Deleted && c.created[change.ID] && !c.copied(change.ID)) {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func (c *syncCollector) copied(id string) bool {
+	n, err := strconv.ParseInt(id, 10, 64)
+	return err == nil && n <= c.copiedThrough
+}
+
+// Sync Returns the parts changed since a cursor
+// @Summary      Sync parts
+// @Description  Return each part created, updated or deleted since the cursor once, with its current state or a tombstone; without a cursor, copy every part first
+// @Tags         /sync
+// @Accept       cursor, limit
+// @Produce      sync page
+func (r *Repository) Sync(ctx context.Context, since string, limit int) (SyncPage, error) {
+	var cursor syncCursor
+	if since == "" {
+		position, err := r.OutboxHead(ctx)
+		if err != nil {
+			return SyncPage{}, err
+		}
+		cursor = syncCursor{seq: position, snapshot: true}
+	} else {
+		var err error
+		if cursor, err = parseSyncCursor(since); err != nil {
+			return SyncPage{}, err
+		}
+	}
+
+	collector := &syncCollector{index: map[string]int{}, created: map[string]bool{}}
+	page := SyncPage{}
+
+	// A first sync copies the parts table, then catches up from the outbox
+	// position taken before it started, so changes made meanwhile are not lost
+	if cursor.snapshot {
+		parts, err := r.syncSnapshot(ctx, cursor.afterID, limit+1)
+		if err != nil {
+			return SyncPage{}, err
+		}
+		if len(parts) > limit {
+			parts, page.HasMore = parts[:limit], true
+		}
+		for i := range parts {
+			collector.put(SyncChange{ID: parts[i].ID, Part: &parts[i]})
+		}
+		if len(parts) > 0 {
+			cursor.afterID, _ = strconv.ParseInt(parts[len(parts)-1].ID, 10, 64)
+		}
+		if page.HasMore {
+			page.Changes, page.Cursor = collector.result(), cursor.String()
+			return page, nil
+		}
+		cursor.snapshot, cursor.catchingUp = false, true
+	} else {
+		expired, err := r.CursorExpired(ctx, cursor.seq)
+		if err != nil {
+			return SyncPage{}, err
+		}
+		if expired {
+			return SyncPage{}, errCursorExpired
+		}
+	}
+
+	// Parts copied before they were deleted must get their tombstone until
+	// the first sync has caught up past every change made while copying
+	if cursor.catchingUp {
+		collector.copiedThrough = cursor.afterID
+	}
+	for !page.HasMore {
+		events, err := r.ReadEvents(ctx, cursor.seq, outboxBatchSize)
+		if err != nil {
+			return SyncPage{}, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			if !collector.has(event.PartID) {
+				if len(collector.changes) >= limit {
+					page.HasMore = true
+					break
+				}
+				collector.created[event.PartID] = event.Type == EventPartCreated
+			}
+			if event.Type == EventPartDeleted {
+				collector.put(SyncChange{ID: event.PartID, Deleted: true})
+			} else if event.Part != nil {
+				collector.put(SyncChange{ID: event.PartID, Part: event.Part})
+			}
+			cursor.seq = event.Seq
+		}
+	}
+
+	if !page.HasMore {
+		cursor.catchingUp, cursor.afterID = false, 0
+	}
+	page.Changes, page.Cursor = collector.result(), cursor.String()
+	return page, nil
+}
+
+// syncSnapshot returns up to limit parts after a part ID, without costs.
+func (r *Repository) syncSnapshot(ctx context.Context, afterID int64, limit int) ([]Part, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+partColumns+`, `+latestVersionColumn+` FROM parts WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []Part
+	for rows.Next() {
+		part, err := scanPartWithVersion(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		part.Cost, part.LandedCosts = nil, nil
+		parts = append(parts, part)
+	}
+	return parts, rows.Err()
+}
+
+// VersionConflict is returned for an edit based on a version of a part that
+// is no longer the newest, and that could not be merged with the changes
+// saved since. Merged is the part with every change that did merge and the
+// current value of each conflict; it is nil when the base version is
+// unknown.
+type VersionConflict struct {
+	BaseVersion    int             `json:"base_version"`
+	CurrentVersion int             `json:"current_version"`
+	Current        Part            `json:"current"`
+	Merged         *Part           `json:"merged,omitempty"`
+	Conflicts      []MergeConflict `json:"conflicts,omitempty"`
+}
+
+func (c *VersionConflict) Error() string {
+	if c.Merged == nil {
+		return fmt.Sprintf("version %d of the part is unknown; the current version is %d", c.BaseVersion, c.CurrentVersion)
+	}
+	return fmt.Sprintf("%d changes conflict with the versions saved since version %d; the current version is %d", len(c.Conflicts), c.BaseVersion, c.CurrentVersion)
+}
+
+// UpdatePartFromVersion Updates a part edited from a known version
+// @Summary      Update Part from version
+// @Description  Save a new version of a part edited from baseVersion, three-way merged with the versions saved since; return a *VersionConflict if the merge conflicts
+// @Tags         /parts/{id}
+// @Accept       part id, part, base version
+// @Produce      merged part, error
+func (r *Repository) UpdatePartFromVersion(ctx context.Context, id string, part Part, baseVersion int) (Part, error) {
+	var saved Part
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := lockPart(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current.Version != baseVersion {
+			if baseVersion > current.Version {
+				return &VersionConflict{BaseVersion: baseVersion, CurrentVersion: current.Version, Current: current}
+			}
+			base, err := getPartVersion(ctx, tx, id, baseVersion)
+			if err != nil {
+				return err
+			}
+			merged, conflicts, err := mergeParts(base, current, part)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				merged.Version = current.Version
+				return &VersionConflict{BaseVersion: baseVersion, CurrentVersion: current.Version, Current: current, Merged: &merged, Conflicts: conflicts}
+			}
+			part = merged
+		}
+
+		if err := updatePart(ctx, tx, id, part, EventPartUpdated, 0); err != nil {
+			return err
+		}
+		saved, err = getPart(ctx, tx, id)
+		return err
+	})
+	return saved, err
+}
+
+// lockPart reads a part and locks its row until the transaction ends, so
+// that its version cannot change meanwhile.
+func lockPart(ctx context.Context, tx *sql.Tx, id string) (Part, error) {
+	query := `SELECT ` + partColumns + `, ` + latestVersionColumn + ` FROM parts WHERE id = ? FOR UPDATE`
+	part, err := scanPartWithVersion(tx.QueryRowContext(ctx, query, id).Scan)
+	if err == sql.ErrNoRows {
+		return Part{}, fmt.Errorf("part %w", errNotFound)
+	}
+	return part, err
+}
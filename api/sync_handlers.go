@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Sync feed Handler
+func SyncHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit := syncDefaultLimit
+		if value := query.Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 || limit > syncMaxLimit {
+				http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		since := query.Get("since")
+		if since != "" {
+			if _, err := parseSyncCursor(since); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		page, err := repository.Sync(r.Context(), since, limit)
+		if err == errCursorExpired {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		} else if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+// writeVersionConflict answers an edit that could not be merged with the
+// conflict document, so that the client can resolve the conflicts in the
+// merged part and send it again from the current version. Callers who
+// cannot see costs only learn that costs conflict.
+func writeVersionConflict(w http.ResponseWriter, r *http.Request, conflict *VersionConflict) {
+	if !hasPermission(r, PermViewCost) {
+		conflict.Current.Cost, conflict.Current.LandedCosts = nil, nil
+		if conflict.Merged != nil {
+			conflict.Merged.Cost, conflict.Merged.LandedCosts = nil, nil
+		}
+		for i, c := range conflict.Conflicts {
+			if c.Field == "cost" || c.Field == "landed_costs" {
+				conflict.Conflicts[i] = MergeConflict{Field: c.Field}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+		*VersionConflict
+	}{conflict.Error(), conflict})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSyncCursor(t *testing.T) {
+	tests := []struct {
+		value string
+		want  syncCursor
+		err   bool
+	}{
+		{value: "0", want: syncCursor{}},
+		{value: "42", want: syncCursor{seq: 42}},
+		{value: "42.17", want: syncCursor{seq: 42, snapshot: true, afterID: 17}},
+		{value: "42~17", want: syncCursor{seq: 42, catchingUp: true, afterID: 17}},
+		{value: "", err: true},
+		{value: "-1", err: true},
+		{value: "42.", err: true},
+		{value: "42~x", err: true},
+		{value: "42.-3", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSyncCursor(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseSyncCursor(%q) = %+v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSyncCursor(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+		if s := got.String(); s != tt.value {
+			t.Errorf("String() = %q, want %q", s, tt.value)
+		}
+	}
+}
+
+func TestSyncCollectorResult(t *testing.T) {
+	part := &Part{ID: "3"}
+	tests := []struct {
+		name          string
+		copiedThrough int64
+		created       map[string]bool
+		changes       []SyncChange
+		want          []SyncChange
+	}{
+		{
+			name:    "created and deleted within the page",
+			created: map[string]bool{"3": true},
+			changes: []SyncChange{{ID: "3", Deleted: true}},
+			want:    []SyncChange{},
+		},
+		{
+			name:    "created and still there",
+			created: map[string]bool{"3": true},
+			changes: []SyncChange{{ID: "3", Part: part}},
+			want:    []SyncChange{{ID: "3", Part: part}},
+		},
+		{
+			name:    "deleted after an earlier page",
+			created: map[string]bool{"3": false},
+			changes: []SyncChange{{ID: "3", Deleted: true}},
+			want:    []SyncChange{{ID: "3", Deleted: true}},
+		},
+		{
+			name:          "created and deleted after the first sync copied it",
+			copiedThrough: 5,
+			created:       map[string]bool{"3": true, "7": true},
+			changes:       []SyncChange{{ID: "3", Deleted: true}, {ID: "7", Deleted: true}},
+			want:          []SyncChange{{ID: "3", Deleted: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &syncCollector{index: map[string]int{}, created: tt.created, copiedThrough: tt.copiedThrough}
+			for _, change := range tt.changes {
+				collector.put(change)
+			}
+			if got := collector.result(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("result = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Delivery states. Deliveries that fail webhookMaxAttempts times become
+// dead letters and are only sent again on request.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryRetrying  = "retrying"
+	DeliveryDead      = "dead"
+)
+
+const (
+	webhookMaxAttempts = 8
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+	webhookTimeout     = 10 * time.Second
+	// webhookBatch is how many deliveries a dispatcher claims at a time.
+	webhookBatch = 10
+	// webhookLease is how long a dispatcher owns the deliveries it claimed,
+	// so that one interrupted by a crash is sent again. They are sent one
+	// after another, so the lease covers a timeout for each of them.
+	webhookLease = webhookBatch*webhookTimeout + time.Minute
+)
+
+type WebhookSubscription struct {
+	ID          int64    `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
+	Active      bool     `json:"active"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	DeliveredAt    string          `json:"delivered_at,omitempty"`
+}
+
+type WebhookAttempt struct {
+	Attempt     int    `json:"attempt"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DurationMS  int64  `json:"duration_ms"`
+	AttemptedAt string `json:"attempted_at"`
+}
+
+// webhookBackoff returns the wait after the given number of failed
+// attempts: 30s doubling each time, up to 6h.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, webhookMaxBackoff)
+}
+
+// signWebhook returns the X-PDM-Signature header for a payload: the
+// timestamp and the hex HMAC-SHA256 of "<timestamp>.<payload>".
+func signWebhook(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (s *WebhookSubscription) validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalidf("url must be an absolute http or https URL")
+	}
+	if len(s.Events) == 0 {
+		return invalidf("events is required")
+	}
+	for _, event := range s.Events {
+		if !eventTypes[event] && event != "*" {
+			return invalidf("unknown event type %q", event)
+		}
+	}
+	return nil
+}
+
+func (s *WebhookSubscription) wants(eventType string) bool {
+	for _, event := range s.Events {
+		if event == eventType || event == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+const webhookColumns = `id, url, events, description, active, created_at`
+
+func scanWebhook(scan func(dest ...interface{}) error) (WebhookSubscription, error) {
+	var subscription WebhookSubscription
+	var events []byte
+	if err := scan(&subscription.ID, &subscription.URL, &events, &subscription.Description, &subscription.Active, &subscription.CreatedAt); err != nil {
+		return WebhookSubscription{}, err
+	}
+	return subscription, json.Unmarshal(events, &subscription.Events)
+}
+
+// CreateWebhook Subscribes a URL to part events
+// @Summary      Create webhook
+// @Description  Subscribe a URL to event types; the signing secret is only returned here
+// @Tags         /webhooks
+// @Accept       subscription
+// @Produce      subscription
+func (r *Repository) CreateWebhook(ctx context.Context, subscription WebhookSubscription) (WebhookSubscription, error) {
+	if err := subscription.validate(); err != nil {
+		return WebhookSubscription{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	events, err := json.Marshal(subscription.Events)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `INSERT INTO webhook_subscriptions (url, events, description, secret, active) VALUES (?, ?, ?, ?, TRUE)`,
+		subscription.URL, events, subscription.Description, "whsec_"+secret)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	created, err := r.GetWebhook(ctx, id)
+	created.Secret = "whsec_" + secret
+	return created, err
+}
+
+// GetWebhook Get a webhook subscription
+// @Summary      Get webhook
+// @Description  Get a webhook subscription without its secret
+// @Tags         /webhooks/{id}
+// @Accept       id
+// @Produce      subscription
+func (r *Repository) GetWebhook(ctx context.Context, id int64) (WebhookSubscription, error) {
+	subscription, err := scanWebhook(r.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return WebhookSubscription{}, fmt.Errorf("webhook %w", errNotFound)
+	}
+	return subscription, err
+}
+
+// ListWebhooks List webhook subscriptions
+// @Summary      List webhooks
+// @Description  List webhook subscriptions without their secrets
+// @Tags         /webhooks
+// @Produce      subscriptions
+func (r *Repository) ListWebhooks(ctx context.Context) ([]WebhookSubscription, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanWebhook(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// UpdateWebhook Changes a webhook subscription
+// @Summary      Update webhook
+// @Description  Change the URL, events, description or active flag of a subscription
+// @Tags         /webhooks/{id}
+// @Accept       id, subscription
+// @Produce      subscription
+func (r *Repository) UpdateWebhook(ctx context.Context, id int64, subscription WebhookSubscription) (WebhookSubscription, error) {
+	if err := subscription.validate(); err != nil {
+		return WebhookSubscription{}, err
+	}
+	events, err := json.Marshal(subscription.Events)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	if _, err := r.GetWebhook(ctx, id); err != nil {
+		return WebhookSubscription{}, err
+	}
+	_, err = r.db.ExecContext(ctx, `UPDATE webhook_subscriptions SET url = ?, events = ?, description = ?, active = ? WHERE id = ?`,
+		subscription.URL, events, subscription.Description, subscription.Active, id)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	return r.GetWebhook(ctx, id)
+}
+
+// DeleteWebhook Deletes a webhook subscription
+// @Summary      Delete webhook
+// @Description  Delete a subscription and its delivery log
+// @Tags         /webhooks/{id}
+// @Accept       id
+// @Produce      error
+func (r *Repository) DeleteWebhook(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE a FROM webhook_attempts a JOIN webhook_deliveries d ON d.id = a.delivery_id WHERE d.subscription_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE subscription_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("webhook %w", errNotFound)
+	}
+	return nil
+}
+
+// EnqueueWebhooks queues a delivery of the event to every active
+// subscription that wants it. The dispatcher sends them. An event already
+// queued for a subscription is not queued again.
+func (r *Repository) EnqueueWebhooks(ctx context.Context, event Event) error {
+	subscriptions, err := r.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		if !subscription.Active || !subscription.wants(event.Type) {
+			continue
+		}
+		_, err := r.db.ExecContext(ctx, `INSERT IGNORE INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			subscription.ID, event.ID, event.Type, payload, DeliveryPending, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, status, attempts, COALESCE(next_attempt_at, ''), COALESCE(last_status_code, 0), last_error, created_at, COALESCE(delivered_at, '')`
+
+func scanDelivery(scan func(dest ...interface{}) error) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+	return d, err
+}
+
+type DeliveryFilter struct {
+	SubscriptionID int64
+	Status         string
+	Limit          int
+}
+
+// ListWebhookDeliveries List webhook deliveries
+// @Summary      List webhook deliveries
+// @Description  List deliveries newest first, optionally for one subscription or status; status dead is the dead-letter list
+// @Tags         /webhooks/deliveries
+// @Accept       subscription id, status, limit
+// @Produce      deliveries
+func (r *Repository) ListWebhookDeliveries(ctx context.Context, filter DeliveryFilter) ([]WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE 1 = 1`
+	var args []interface{}
+	if filter.SubscriptionID != 0 {
+		query += ` AND subscription_id = ?`
+		args = append(args, filter.SubscriptionID)
+	}
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery Get a delivery with its payload and attempts
+// @Summary      Get webhook delivery
+// @Description  Get a delivery with its payload and every attempt
+// @Tags         /webhooks/deliveries/{deliveryId}
+// @Accept       delivery id
+// @Produce      delivery, attempts
+func (r *Repository) GetWebhookDelivery(ctx context.Context, id int64) (WebhookDelivery, []WebhookAttempt, error) {
+	var payload []byte
+	delivery, err := scanDelivery(func(dest ...interface{}) error {
+		return r.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+`, payload FROM webhook_deliveries WHERE id = ?`, id).Scan(append(dest, &payload)...)
+	})
+	if err == sql.ErrNoRows {
+		return WebhookDelivery{}, nil, fmt.Errorf("delivery %w", errNotFound)
+	} else if err != nil {
+		return WebhookDelivery{}, nil, err
+	}
+	delivery.Payload = payload
+
+	rows, err := r.db.QueryContext(ctx, `SELECT attempt, COALESCE(status_code, 0), error, duration_ms, attempted_at FROM webhook_attempts WHERE delivery_id = ? ORDER BY attempt`, id)
+	if err != nil {
+		return WebhookDelivery{}, nil, err
+	}
+	defer rows.Close()
+
+	attempts := []WebhookAttempt{}
+	for rows.Next() {
+		var attempt WebhookAttempt
+		if err := rows.Scan(&attempt.Attempt, &attempt.StatusCode, &attempt.Error, &attempt.DurationMS, &attempt.AttemptedAt); err != nil {
+			return WebhookDelivery{}, nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return delivery, attempts, rows.Err()
+}
+
+// RetryWebhookDelivery Sends a dead letter again
+// @Summary      Retry webhook delivery
+// @Description  Move a dead or failing delivery back to pending so that it is sent right away
+// @Tags         /webhooks/deliveries/{deliveryId}/retry
+// @Accept       delivery id
+// @Produce      error
+func (r *Repository) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, next_attempt_at = ? WHERE id = ? AND status IN (?, ?)`,
+		DeliveryPending, time.Now().UTC(), id, DeliveryDead, DeliveryRetrying)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("delivery %w or not failed", errNotFound)
+	}
+	return nil
+}
+
+type dueDelivery struct {
+	id       int64
+	eventID  string
+	event    string
+	payload  []byte
+	attempts int
+	url      string
+	secret   string
+	// requestID is the request ID of the change the event is about
+	requestID string
+}
+
+// claimDueDeliveries leases up to limit deliveries whose next attempt is due.
+// SKIP LOCKED lets several API instances dispatch without sending a delivery
+// twice at the same time.
+func (r *Repository) claimDueDeliveries(ctx context.Context, limit int) ([]dueDelivery, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.id, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret
+		FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status IN (?, ?) AND d.next_attempt_at <= ? AND s.active
+		ORDER BY d.id LIMIT ? FOR UPDATE OF d SKIP LOCKED`, DeliveryPending, DeliveryRetrying, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.eventID, &d.event, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var event Event
+		if json.Unmarshal(d.payload, &event) == nil {
+			d.requestID = event.RequestID
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range due {
+		if _, err := tx.ExecContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ?`, now.Add(webhookLease), d.id); err != nil {
+			return nil, err
+		}
+	}
+	return due, tx.Commit()
+}
+
+// recordAttempt logs an attempt and moves the delivery to its next state.
+func (r *Repository) recordAttempt(ctx context.Context, d dueDelivery, statusCode int, sendErr error, duration time.Duration) error {
+	attempt := d.attempts + 1
+	now := time.Now().UTC()
+	message := ""
+	if sendErr != nil {
+		message = sendErr.Error()
+	}
+	var code interface{}
+	if statusCode != 0 {
+		code = statusCode
+	}
+
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		d.id, attempt, code, message, duration.Milliseconds(), now); err != nil {
+		return err
+	}
+
+	switch {
+	case sendErr == nil:
+		_, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?, last_error = '', next_attempt_at = NULL, delivered_at = ? WHERE id = ?`,
+			DeliverySucceeded, attempt, code, now, d.id)
+		return err
+	case attempt >= webhookMaxAttempts:
+		_, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = NULL WHERE id = ?`,
+			DeliveryDead, attempt, code, message, d.id)
+		return err
+	default:
+		_, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+			DeliveryRetrying, attempt, code, message, now.Add(webhookBackoff(attempt)), d.id)
+		return err
+	}
+}
+
+// sendWebhook posts a signed payload and returns the response status. Any
+// status other than 2xx is an error.
+func sendWebhook(ctx context.Context, client *http.Client, d dueDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pdm-webhooks/1")
+	req.Header.Set("X-PDM-Event", d.event)
+	req.Header.Set("X-PDM-Event-ID", d.eventID)
+	req.Header.Set("X-PDM-Delivery", strconv.FormatInt(d.id, 10))
+	req.Header.Set("X-PDM-Signature", signWebhook(d.secret, time.Now().Unix(), d.payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// DispatchWebhooks sends the deliveries that are due and returns how many
+// it attempted.
+func (r *Repository) DispatchWebhooks(ctx context.Context, client *http.Client) (int, error) {
+	due, err := r.claimDueDeliveries(ctx, webhookBatch)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range due {
+		deliveryCtx := withRequestID(ctx, d.requestID)
+		start := time.Now()
+		status, sendErr := sendWebhook(deliveryCtx, client, d)
+		if sendErr != nil {
+			slog.WarnContext(deliveryCtx, "Webhook delivery failed", "delivery_id", d.id, "event_id", d.eventID, "attempt", d.attempts+1, "error", sendErr)
+		}
+		if err := r.recordAttempt(deliveryCtx, d, status, sendErr, time.Since(start)); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// StartWebhookDispatcher sends due webhook deliveries every interval until
+// stop is closed.
+func StartWebhookDispatcher(repository *Repository, interval time.Duration, stop <-chan struct{}) {
+	ctx := context.Background()
+	client := &http.Client{Timeout: webhookTimeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches are due, so a backlog drains quickly
+		for {
+			n, err := repository.DispatchWebhooks(ctx, client)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to dispatch webhooks", "error", err)
+			}
+			if err != nil || n < webhookBatch {
+				break
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
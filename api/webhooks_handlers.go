@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func webhookID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid "+name, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// List webhooks Handler
+func ListWebhooksHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subscriptions, err := repository.ListWebhooks(r.Context())
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subscriptions)
+	}
+}
+
+// Create webhook Handler
+func CreateWebhookHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var subscription WebhookSubscription
+		if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		created, err := repository.CreateWebhook(r.Context(), subscription)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	}
+}
+
+// Get webhook Handler
+func GetWebhookHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := webhookID(w, r, "id")
+		if !ok {
+			return
+		}
+
+		subscription, err := repository.GetWebhook(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(subscription)
+	}
+}
+
+// Update webhook Handler
+func UpdateWebhookHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := webhookID(w, r, "id")
+		if !ok {
+			return
+		}
+		if _, err := repository.GetWebhook(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		var subscription WebhookSubscription
+		if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updated, err := repository.UpdateWebhook(r.Context(), id, subscription)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+// Delete webhook Handler
+func DeleteWebhookHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := webhookID(w, r, "id")
+		if !ok {
+			return
+		}
+
+		if err := repository.DeleteWebhook(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// List webhook deliveries Handler serves the delivery log of one
+// subscription, or of all of them; status=dead lists the dead letters.
+func ListWebhookDeliveriesHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := DeliveryFilter{Status: r.URL.Query().Get("status"), Limit: 100}
+		if _, ok := mux.Vars(r)["id"]; ok {
+			id, ok := webhookID(w, r, "id")
+			if !ok {
+				return
+			}
+			if _, err := repository.GetWebhook(r.Context(), id); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			filter.SubscriptionID = id
+		}
+		switch filter.Status {
+		case "", DeliveryPending, DeliverySucceeded, DeliveryRetrying, DeliveryDead:
+		default:
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 || limit > 1000 {
+				http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		deliveries, err := repository.ListWebhookDeliveries(r.Context(), filter)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries)
+	}
+}
+
+// Get webhook delivery Handler
+func GetWebhookDeliveryHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := webhookID(w, r, "deliveryId")
+		if !ok {
+			return
+		}
+
+		delivery, attempts, err := repository.GetWebhookDelivery(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			WebhookDelivery
+			AttemptLog []WebhookAttempt `json:"attempt_log"`
+		}{delivery, attempts})
+	}
+}
+
+// Retry webhook delivery Handler
+func RetryWebhookDeliveryHandler(repository *Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := webhookID(w, r, "deliveryId")
+		if !ok {
+			return
+		}
+
+		if err := repository.RetryWebhookDelivery(r.Context(), id); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -6,6 +6,7 @@ import './AddPartForm.css';
 const AddPartForm = () => {
   const [name, setName] = useState('');
   const [price, setPrice] = useState('');
+  const [currency, setCurrency] = useState('USD');
   const [images, setImages] = useState('');
   const [sku, setSku] = useState('');
   const [description, setDescription] = useState('');
@@ -30,7 +31,8 @@ const AddPartForm = () => {
         .then(response => {
           const part = response.data;
           setName(part.name);
-          setPrice(part.price);
+          setPrice(part.price.amount);
+          setCurrency(part.price.currency);
           setImages(part.images.join(','));
           setSku(part.sku);
           setDescription(part.description);
@@ -54,7 +56,7 @@ const AddPartForm = () => {
 
     const part = {
       name,
-      price: parseFloat(price),
+      price: { amount: String(price), currency },
       images: images ? images.split(',') : [],
       sku,
       description,
@@ -14,15 +14,93 @@ const PartsList = () => {
   const navigate = useNavigate();
 
   useEffect(() => {
-    axios.get('http://localhost:1710/parts')
-      .then(response => {
-        setParts(response.data || []);
-        setLoading(false);
-      })
-      .catch(error => {
-        setError(error);
-        setLoading(false);
-      });
+    let source = null;
+    let retry = null;
+    let cursor = null;
+    let loaded = false;
+    let queued = [];
+
+    const loadParts = () => {
+      loaded = false;
+      axios.get('http://localhost:1710/parts')
+        .then(response => {
+          setParts(response.data || []);
+          loaded = true;
+          queued.forEach(applyEvent);
+          queued = [];
+          setLoading(false);
+        })
+        .catch(error => {
+          setError(error);
+          setLoading(false);
+        });
+    };
+
+    const applyEvent = (event) => {
+      if (event.type === 'stream.reset') {
+        loadParts();
+      } else if (event.type === 'part.deleted') {
+        setParts(parts => parts.filter(part => part.id !== event.part_id));
+      } else if (event.part) {
+        setParts(parts => parts.some(part => part.id === event.part_id)
+          ? parts.map(part => part.id === event.part_id ? event.part : part)
+          : [...parts, event.part]);
+      }
+    };
+
+    const onEvent = (message) => {
+      cursor = message.lastEventId;
+      const event = JSON.parse(message.data);
+      if (loaded || event.type === 'stream.reset') {
+        applyEvent(event);
+      } else {
+        queued.push(event);
+      }
+    };
+
+    const start = () => {
+      if (cursor === null) {
+        cursor = '';
+        loadParts();
+      }
+    };
+
+    // Keep the list current with the change stream. The list is loaded once the
+    // stream is open, so no change falls between the two; events that arrive
+    // first are applied on top of it.
+    const open = (token) => {
+      const params = new URLSearchParams();
+      if (cursor) params.set('cursor', cursor);
+      if (token) params.set('access_token', token);
+      source = new EventSource(`http://localhost:1710/events?${params}`, { withCredentials: true });
+      source.onopen = start;
+      ['part.created', 'part.updated', 'part.deleted', 'version.restored', 'stream.reset']
+        .forEach(type => source.addEventListener(type, onEvent));
+      // EventSource reconnects on its own unless the server refused it, e.g. with an expired token
+      source.onerror = () => {
+        if (source.readyState === EventSource.CLOSED) {
+          start();
+          retry = setTimeout(connect, 5000);
+        }
+      };
+    };
+
+    // API keys cannot go in a URL, so exchange the key for a short-lived token
+    const connect = () => {
+      if (process.env.REACT_APP_API_KEY) {
+        axios.post('http://localhost:1710/auth/token')
+          .then(response => open(response.data.access_token))
+          .catch(() => open());
+      } else {
+        open();
+      }
+    };
+
+    connect();
+    return () => {
+      clearTimeout(retry);
+      if (source) source.close();
+    };
   }, []);
 
   const toggleExpand = (id) => {
@@ -55,7 +133,7 @@ const PartsList = () => {
             const part = response.data;
             alert(`
                 Name: ${part.name}
-                Price: ${part.price}
+                Price: ${part.price.amount} ${part.price.currency}
                 Images: ${part.images ? part.images.join(', ') : 'None'}
                 SKU: ${part.sku}
                 Description: ${part.description}
@@ -103,7 +181,7 @@ const PartsList = () => {
               </div>
               {expandedPart === part.id && (
                 <div className="part-details">
-                  <div><strong>Price:</strong> ${part.price}</div>
+                  <div><strong>Price:</strong> {part.price.amount} {part.price.currency}</div>
                   <div><strong>Images:</strong> {part.images ? part.images.join(', ') : 'None'}</div>
                   <div><strong>SKU:</strong> {part.sku}</div>
                   <div><strong>Description:</strong> {part.description}</div>
@@ -67,7 +67,7 @@ const SearchPage = () => {
                     <li key={result.id}>
                         <div className="part-details">
                             <strong>{result.name}</strong>
-                            <div><strong>Price:</strong> ${result.price}</div>
+                            <div><strong>Price:</strong> {result.price.amount} {result.price.currency}</div>
                             <div><strong>SKU:</strong> {result.sku}</div>
                             <div><strong>Description:</strong> {result.description}</div>
                             <div><strong>Location:</strong> {result.location}</div>
@@ -6,6 +6,7 @@ import './UpdatePartForm.css';
 const UpdatePartForm = () => {
   const [name, setName] = useState('');
   const [price, setPrice] = useState('');
+  const [currency, setCurrency] = useState('USD');
   const [images, setImages] = useState('');
   const [sku, setSku] = useState('');
   const [description, setDescription] = useState('');
@@ -31,7 +32,8 @@ const UpdatePartForm = () => {
         .then(response => {
           const part = response.data;
           setName(part.name);
-          setPrice(part.price);
+          setPrice(part.price.amount);
+          setCurrency(part.price.currency);
           setImages(part.images.join(','));
           setSku(part.sku);
           setDescription(part.description);
@@ -55,7 +57,7 @@ const UpdatePartForm = () => {
 
     const part = {
       name,
-      price: parseFloat(price),
+      price: { amount: String(price), currency },
       images: images ? images.split(',') : [],
       sku,
       description,
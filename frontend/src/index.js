@@ -4,6 +4,28 @@ import React from 'react';
 import ReactDOM from 'react-dom';
 import './index.css';
 import App from './App';
+import axios from 'axios';
+
+const API_URL = 'http://localhost:1710';
+
+// Local development key; see Authentication in the README
+if (process.env.REACT_APP_API_KEY) {
+  axios.defaults.headers.common['X-API-Key'] = process.env.REACT_APP_API_KEY;
+} else {
+  // Otherwise sign in through OIDC; the session cookie needs the CSRF token on changes
+  axios.defaults.withCredentials = true;
+  axios.get(API_URL + '/auth/me').then(response => {
+    if (response.data.csrf_token) {
+      axios.defaults.headers.common['X-CSRF-Token'] = response.data.csrf_token;
+    }
+  }).catch(() => {});
+  axios.interceptors.response.use(undefined, error => {
+    if (error.response && error.response.status === 401) {
+      window.location.href = API_URL + '/auth/login?return_to=' + encodeURIComponent(window.location.href);
+    }
+    return Promise.reject(error);
+  });
+}
 
 ReactDOM.render(
   <React.StrictMode>
@@ -0,0 +1,146 @@
+// Command audit-verify checks an audit log export from GET /audit/export
+// without access to the server or its database. It recomputes every entry's
+// hash and the chain between them, and reports gaps and modified entries.
+//
+//	audit-verify [-anchor-seq N -anchor-hash HASH] audit.jsonl
+//
+// With no file it reads standard input. It exits with status 1 when the log
+// does not verify.
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+type entry struct {
+	Seq        int64           `json:"seq"`
+	OccurredAt string          `json:"occurred_at"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id"`
+	Action     string          `json:"action"`
+	Entity     string          `json:"entity"`
+	EntityID   string          `json:"entity_id"`
+	Details    json.RawMessage `json:"details"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// hash is the SHA-256 of the previous hash, a newline and the compact JSON
+// of the fields from seq to details, as computed by the API.
+func (e entry) hash() (string, error) {
+	data, err := json.Marshal(struct {
+		Seq        int64           `json:"seq"`
+		OccurredAt string          `json:"occurred_at"`
+		Actor      string          `json:"actor"`
+		RequestID  string          `json:"request_id"`
+		Action     string          `json:"action"`
+		Entity     string          `json:"entity"`
+		EntityID   string          `json:"entity_id"`
+		Details    json.RawMessage `json:"details"`
+	}{e.Seq, e.OccurredAt, e.Actor, e.RequestID, e.Action, e.Entity, e.EntityID, e.Details})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// problem is something wrong with the entry at Seq.
+type problem struct {
+	Seq     int64
+	Message string
+}
+
+// verify checks the JSON lines of an export and returns its problems and
+// the sequence number and hash of its last entry. An anchorSeq of 0 means
+// no anchor.
+func verify(input io.Reader, anchorSeq int64, anchorHash string) ([]problem, int64, string, error) {
+	var problems []problem
+	report := func(seq int64, format string, args ...interface{}) {
+		problems = append(problems, problem{Seq: seq, Message: fmt.Sprintf(format, args...)})
+	}
+
+	headSeq, headHash := int64(0), strings.Repeat("0", 64)
+	anchorFound := false
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 1<<20), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, 0, "", fmt.Errorf("line %d: %v", line, err)
+		}
+
+		switch expected := headSeq + 1; {
+		case e.Seq > expected:
+			report(e.Seq, "entries %d to %d are missing", expected, e.Seq-1)
+		case e.Seq < expected:
+			report(e.Seq, "entry is out of order or duplicated after entry %d", headSeq)
+		}
+		if e.PrevHash != headHash {
+			report(e.Seq, "previous hash does not match the hash of entry %d", headSeq)
+		}
+		if hash, err := e.hash(); err != nil {
+			report(e.Seq, "cannot hash entry: %v", err)
+		} else if hash != e.Hash {
+			report(e.Seq, "entry has been modified: its hash does not match its contents")
+		}
+		if anchorSeq > 0 && e.Seq == anchorSeq {
+			anchorFound = true
+			if e.Hash != anchorHash {
+				report(e.Seq, "hash does not match the recorded anchor")
+			}
+		}
+		headSeq, headHash = e.Seq, e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, "", err
+	}
+	if anchorSeq > 0 && !anchorFound {
+		report(anchorSeq, "recorded anchor entry is missing: the log has been truncated")
+	}
+	return problems, headSeq, headHash, nil
+}
+
+func main() {
+	anchorSeq := flag.Int64("anchor-seq", 0, "sequence number of an entry recorded from an earlier verification")
+	anchorHash := flag.String("anchor-hash", "", "hash recorded for -anchor-seq")
+	flag.Parse()
+	log.SetFlags(0)
+
+	var input io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	problems, headSeq, headHash, err := verify(input, *anchorSeq, *anchorHash)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range problems {
+		fmt.Printf("entry %d: %s\n", p.Seq, p.Message)
+	}
+
+	fmt.Printf("head %d %s\n", headSeq, headHash)
+	if len(problems) > 0 {
+		fmt.Printf("FAILED: %d problems\n", len(problems))
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const genesis = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// chain returns n correctly chained entries.
+func chain(t *testing.T, n int) []entry {
+	t.Helper()
+	entries := make([]entry, n)
+	prev := genesis
+	for i := range entries {
+		e := entry{
+			Seq:        int64(i + 1),
+			OccurredAt: fmt.Sprintf("2024-01-01T00:00:%02d.000000Z", i),
+			Actor:      "key:abc",
+			RequestID:  fmt.Sprintf("req-%d", i+1),
+			Action:     "PUT /parts/{id}",
+			Entity:     "parts",
+			EntityID:   "42",
+			Details:    json.RawMessage(`{"status":200}`),
+			PrevHash:   prev,
+		}
+		hash, err := e.hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Hash, prev = hash, hash
+		entries[i] = e
+	}
+	return entries
+}
+
+func export(t *testing.T, entries []entry) string {
+	t.Helper()
+	var b strings.Builder
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestHash(t *testing.T) {
+	// The same entry and hash as TestAuditHash in the API
+	line := `{"seq":1,"occurred_at":"2024-05-01T12:00:00.000000Z","actor":"key:abc","request_id":"req-1","action":"POST /parts","entity":"parts","entity_id":"42","details":{"body":{"name":"Bolt <M6>"},"status":201},"prev_hash":"` + genesis + `","hash":"ca7122c67077da2e0c99302eaf9cffe30b42c2c230bed05580b3efd3254bc8ed"}`
+	problems, head, _, err := verify(strings.NewReader(line), 0, "")
+	if err != nil || len(problems) != 0 || head != 1 {
+		t.Errorf("verify = %v, %d, %v, want no problems", problems, head, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		edit       func([]entry) []entry
+		anchorSeq  int64
+		anchorHash func([]entry) string
+		problems   []problem
+	}{
+		{
+			name: "intact chain",
+			edit: func(e []entry) []entry { return e },
+		},
+		{
+			name:       "intact chain with anchor",
+			edit:       func(e []entry) []entry { return e },
+			anchorSeq:  3,
+			anchorHash: func(e []entry) string { return e[2].Hash },
+		},
+		{
+			name: "modified details",
+			edit: func(e []entry) []entry {
+				e[1].Details = json.RawMessage(`{"status":201}`)
+				return e
+			},
+			problems: []problem{{Seq: 2, Message: "entry has been modified: its hash does not match its contents"}},
+		},
+		{
+			name: "modified and rehashed entry breaks the next link",
+			edit: func(e []entry) []entry {
+				e[1].Actor = "key:other"
+				e[1].Hash, _ = e[1].hash()
+				return e
+			},
+			problems: []problem{{Seq: 3, Message: "previous hash does not match the hash of entry 2"}},
+		},
+		{
+			name: "entries removed",
+			edit: func(e []entry) []entry { return append(e[:1:1], e[3:]...) },
+			problems: []problem{
+				{Seq: 4, Message: "entries 2 to 3 are missing"},
+				{Seq: 4, Message: "previous hash does not match the hash of entry 1"},
+			},
+		},
+		{
+			name: "entry duplicated",
+			edit: func(e []entry) []entry { return append(e[:2:2], e[1:]...) },
+			problems: []problem{
+				{Seq: 2, Message: "entry is out of order or duplicated after entry 2"},
+				{Seq: 2, Message: "previous hash does not match the hash of entry 2"},
+			},
+		},
+		{
+			name:       "truncated before the anchor",
+			edit:       func(e []entry) []entry { return e[:3] },
+			anchorSeq:  4,
+			anchorHash: func(e []entry) string { return e[3].Hash },
+			problems:   []problem{{Seq: 4, Message: "recorded anchor entry is missing: the log has been truncated"}},
+		},
+		{
+			name:       "anchor hash differs",
+			edit:       func(e []entry) []entry { return e },
+			anchorSeq:  2,
+			anchorHash: func(e []entry) string { return e[3].Hash },
+			problems:   []problem{{Seq: 2, Message: "hash does not match the recorded anchor"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := chain(t, 4)
+			var anchorHash string
+			if tt.anchorHash != nil {
+				anchorHash = tt.anchorHash(entries)
+			}
+			entries = tt.edit(entries)
+
+			problems, headSeq, headHash, err := verify(strings.NewReader(export(t, entries)), tt.anchorSeq, anchorHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("problems = %v, want %v", problems, tt.problems)
+			}
+			last := entries[len(entries)-1]
+			if headSeq != last.Seq || headHash != last.Hash {
+				t.Errorf("head = %d %s, want %d %s", headSeq, headHash, last.Seq, last.Hash)
+			}
+		})
+	}
+
+	if _, _, _, err := verify(strings.NewReader("{\n"), 0, ""); err == nil {
+		t.Error("verify of invalid JSON succeeded, want an error")
+	}
+}